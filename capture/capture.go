@@ -0,0 +1,160 @@
+package capture
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// Source is a kind of capture device that ffmpeg knows how to open
+type Source interface {
+	// Kind identifies the source in saved camera settings
+	Kind() string
+	// Devices lists the devices that are currently available
+	Devices() []Device
+	// Modes lists the capture modes a device supports
+	Modes(device string) []Mode
+	// InputArgs returns the ffmpeg arguments that open the device as input
+	InputArgs(device string, input Input) []string
+}
+
+// Device is a camera found by a source
+type Device struct {
+	// ID stays the same across reboots and replugging, and is what ffmpeg opens
+	ID string
+	// Name is the friendly name the device reports
+	Name string
+	// Legacy is how settings referred to the device before IDs were used
+	Legacy string
+}
+
+// Input holds the camera settings a source may need to open a device
+type Input struct {
+	Resolution string
+	FPS        int
+	Timestamp  bool
+	// Format asks the device for a pixel format or codec, empty lets ffmpeg pick
+	Format string
+}
+
+// FormatMJPEG is the format of devices that compress frames themselves
+const FormatMJPEG = "mjpeg"
+
+// Mode is a resolution a device can capture at in one format. Format is empty
+// and the frame rates are 0 when the source doesn't report them. A resolution
+// and format is listed once per frame rate range the device reports for it.
+type Mode struct {
+	Width  int
+	Height int
+	Format string
+	MinFPS float64
+	MaxFPS float64
+}
+
+func (m Mode) Resolution() string {
+	return fmt.Sprintf("%dx%d", m.Width, m.Height)
+}
+
+// Supports reports whether the device can deliver fps frames per second in this mode
+func (m Mode) Supports(fps int) bool {
+	if m.MaxFPS == 0 {
+		return true
+	}
+	return float64(fps) >= math.Floor(m.MinFPS) && float64(fps) <= math.Ceil(m.MaxFPS)
+}
+
+// . Resolutions across modes, smallest first
+// An empty format includes every mode
+func Resolutions(modes []Mode, format string) []string {
+	var found []resolution
+	for _, mode := range modes {
+		if format == "" || mode.Format == format {
+			found = append(found, resolution{mode.Width, mode.Height})
+		}
+	}
+	return sortedResolutions(found)
+}
+
+// MaxFPS returns the highest frame rate of any mode, 0 if unknown
+func MaxFPS(modes []Mode) int {
+	var maxFps float64
+	for _, mode := range modes {
+		maxFps = math.Max(maxFps, mode.MaxFPS)
+	}
+	return int(math.Round(maxFps))
+}
+
+// Formats lists the formats a resolution can be captured in
+func Formats(modes []Mode, resolution string) []string {
+	var formats []string
+	for _, mode := range modes {
+		if mode.Format != "" && mode.Resolution() == resolution && !slices.Contains(formats, mode.Format) {
+			formats = append(formats, mode.Format)
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// FindMode returns the first mode matching a resolution and format
+func FindMode(modes []Mode, resolution, format string) (Mode, bool) {
+	for _, mode := range modes {
+		if mode.Resolution() == resolution && mode.Format == format {
+			return mode, true
+		}
+	}
+	return Mode{}, false
+}
+
+// SupportsFPS reports whether any mode of a resolution and format can deliver
+// fps frames per second. Devices can list one mode with separate ranges.
+func SupportsFPS(modes []Mode, resolution, format string, fps int) bool {
+	for _, mode := range modes {
+		if mode.Resolution() == resolution && mode.Format == format && mode.Supports(fps) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources returns every source whose devices are shown in the UI
+func Sources() []Source {
+	return []Source{Default(), TestPattern{}, Network{}}
+}
+
+// ByKind returns the source saved as kind, settings from before sources were
+// recorded belong to the platform default
+func ByKind(kind string) Source {
+	for _, source := range Sources() {
+		if source.Kind() == kind {
+			return source
+		}
+	}
+	return Default()
+}
+
+type resolution struct {
+	width  int
+	height int
+}
+
+// . Sort and format a set of resolutions
+func sortedResolutions(found []resolution) []string {
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].width != found[j].width {
+			return found[i].width < found[j].width
+		}
+		return found[i].height < found[j].height
+	})
+
+	unique := make(map[resolution]bool)
+	var resolutions []string
+	for _, res := range found {
+		if !unique[res] {
+			resolutions = append(resolutions, fmt.Sprintf("%dx%d", res.width, res.height))
+			unique[res] = true
+		}
+	}
+	return resolutions
+}
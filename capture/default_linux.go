@@ -0,0 +1,9 @@
+package capture
+
+// drawtext relies on fontconfig to find a font
+const timestampFont = ""
+
+// Default returns the capture source for this platform
+func Default() Source {
+	return V4L2{}
+}
@@ -0,0 +1,30 @@
+//go:build !windows && !linux
+
+package capture
+
+// drawtext relies on fontconfig to find a font
+const timestampFont = ""
+
+// Default returns the capture source for this platform
+func Default() Source {
+	return unsupported{}
+}
+
+// unsupported is used where FrameWave has no capture backend yet
+type unsupported struct{}
+
+func (unsupported) Kind() string {
+	return ""
+}
+
+func (unsupported) Devices() []Device {
+	return nil
+}
+
+func (unsupported) Modes(device string) []Mode {
+	return nil
+}
+
+func (unsupported) InputArgs(device string, input Input) []string {
+	return nil
+}
@@ -0,0 +1,9 @@
+package capture
+
+// The bundled ffmpeg has no fontconfig setup, so point drawtext at a font
+const timestampFont = "C\\:/Windows/Fonts/consola.ttf"
+
+// Default returns the capture source for this platform
+func Default() Source {
+	return DirectShow{}
+}
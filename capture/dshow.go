@@ -0,0 +1,120 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"framewave/general"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DirectShow captures from Windows webcams through ffmpeg's dshow input
+type DirectShow struct{}
+
+func (DirectShow) Kind() string {
+	return "dshow"
+}
+
+// . Get cameras
+// Friendly names are shared by identical webcams, so devices are identified by
+// the alternative name listed under them, which ffmpeg accepts in its place
+// [dshow @ 0000020f] "HD Webcam" (video)
+// [dshow @ 0000020f]   Alternative name "@device_pnp_\\?\usb#vid_046d&pid_0825&mi_00#6&2a0a9e7a&0&0000#{65e8773d-8f56-11d0-a3b9-00a0c9223196}\global"
+func (DirectShow) Devices() []Device {
+	//* Build command
+	cmd := general.Command(general.FfmpegPath(), "-list_devices", "true", "-f", "dshow", "-i", "dummy")
+
+	//* Create buffer
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	//* Run command, listing devices always exits with an error
+	_ = cmd.Run()
+
+	//* Parse data
+	reName := regexp.MustCompile(`"([^"]+)" \((\w+)\)`)
+	reAlternative := regexp.MustCompile(`Alternative name "([^"]+)"`)
+
+	var devices []Device
+	isVideo := false
+	for _, line := range strings.Split(out.String(), "\n") {
+		if match := reName.FindStringSubmatch(line); match != nil {
+			isVideo = match[2] == "video"
+			if isVideo {
+				devices = append(devices, Device{ID: match[1], Name: match[1], Legacy: match[1]})
+			}
+			continue
+		}
+		if match := reAlternative.FindStringSubmatch(line); match != nil && isVideo {
+			devices[len(devices)-1].ID = match[1]
+			isVideo = false
+		}
+	}
+
+	return devices
+}
+
+// . Get camera modes
+func (DirectShow) Modes(device string) []Mode {
+	//* Build command
+	cmd := general.Command(general.FfmpegPath(), "-list_options", "true", "-f", "dshow", "-i", "video="+device)
+
+	//* Create buffer
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err != nil {
+		fmt.Printf("Res Error with device %s: %v. Output: %s\n", device, err, out.String())
+	}
+	return parseOptions(out.String())
+}
+
+// Parses `-list_options` lines such as
+// [dshow @ 0000020f]   vcodec=mjpeg  min s=1280x720 fps=5 max s=1280x720 fps=30
+// [dshow @ 0000020f]   pixel_format=yuyv422  min s=640x480 fps=5 max s=640x480 fps=30.0003
+// A mode listed with several frame rate ranges, such as 5-30 and 60, is kept
+// once per range, since the rates between them are refused.
+func parseOptions(output string) []Mode {
+	re := regexp.MustCompile(`(?:vcodec|pixel_format)=(\w+)\s+min s=(\d+)x(\d+) fps=([\d.]+) max s=\d+x\d+ fps=([\d.]+)`)
+	matches := re.FindAllStringSubmatch(output, -1)
+
+	var modes []Mode
+	for _, match := range matches {
+		width, _ := strconv.Atoi(match[2])
+		height, _ := strconv.Atoi(match[3])
+		minFps, _ := strconv.ParseFloat(match[4], 64)
+		maxFps, _ := strconv.ParseFloat(match[5], 64)
+		mode := Mode{Width: width, Height: height, Format: match[1], MinFPS: minFps, MaxFPS: maxFps}
+
+		//* Every pin lists its modes, keep one of each
+		if !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	return modes
+}
+
+func (DirectShow) InputArgs(device string, input Input) []string {
+	args := []string{
+		"-f", "dshow",
+		"-rtbufsize", "100M",
+		"-probesize", "32",
+	}
+
+	//* Pick the device mode instead of letting dshow choose one
+	if input.Format != "" {
+		if input.Format == FormatMJPEG {
+			args = append(args, "-vcodec", input.Format)
+		} else {
+			args = append(args, "-pixel_format", input.Format)
+		}
+		args = append(args, "-video_size", input.Resolution, "-framerate", strconv.Itoa(input.FPS))
+	}
+
+	return append(args, "-i", "video="+device)
+}
@@ -0,0 +1,34 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	output := `[dshow @ 0000020f] DirectShow video device options (from video devices)
+[dshow @ 0000020f]  Pin "Capture" (alternative pin name "0")
+[dshow @ 0000020f]   vcodec=mjpeg  min s=1280x720 fps=5 max s=1280x720 fps=30
+[dshow @ 0000020f]   vcodec=mjpeg  min s=1280x720 fps=60 max s=1280x720 fps=60
+[dshow @ 0000020f]   pixel_format=yuyv422  min s=640x480 fps=5 max s=640x480 fps=30.0003
+[dshow @ 0000020f]  Pin "Still" (alternative pin name "1")
+[dshow @ 0000020f]   vcodec=mjpeg  min s=1280x720 fps=5 max s=1280x720 fps=30
+video=HD Webcam: Immediate exit requested`
+
+	want := []Mode{
+		{Width: 1280, Height: 720, Format: "mjpeg", MinFPS: 5, MaxFPS: 30},
+		{Width: 1280, Height: 720, Format: "mjpeg", MinFPS: 60, MaxFPS: 60},
+		{Width: 640, Height: 480, Format: "yuyv422", MinFPS: 5, MaxFPS: 30.0003},
+	}
+	modes := parseOptions(output)
+	if !reflect.DeepEqual(modes, want) {
+		t.Errorf("parseOptions() = %v, want %v", modes, want)
+	}
+
+	//* The rates between the ranges aren't offered
+	for fps, want := range map[int]bool{30: true, 45: false, 60: true} {
+		if got := SupportsFPS(modes, "1280x720", "mjpeg", fps); got != want {
+			t.Errorf("SupportsFPS(%d) = %v, want %v", fps, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package capture
+
+import (
+	"strings"
+)
+
+// Network reads from a URL (rtsp://, http:// MJPEG) or a local video file.
+// These cameras are added by the user rather than enumerated, so the device is
+// the URL itself. The engine identifies them by a hash of it, as it can hold a
+// password.
+type Network struct{}
+
+func (Network) Kind() string {
+	return "url"
+}
+
+func (Network) Devices() []Device {
+	return nil
+}
+
+// The stream is rescaled anyway, so any common size can be picked
+func (Network) Modes(device string) []Mode {
+	modes := make([]Mode, len(commonResolutions))
+	for i, res := range commonResolutions {
+		modes[i] = Mode{Width: res.width, Height: res.height}
+	}
+	return modes
+}
+
+func (Network) InputArgs(device string, input Input) []string {
+	lower := strings.ToLower(device)
+	switch {
+	case strings.HasPrefix(lower, "rtsp://"), strings.HasPrefix(lower, "rtsps://"):
+		return []string{"-rtsp_transport", "tcp", "-i", device}
+	case strings.Contains(lower, "://"):
+		return []string{"-i", device}
+	default:
+		//* Play local files in real time and loop them like a live feed
+		return []string{"-re", "-stream_loop", "-1", "-i", device}
+	}
+}
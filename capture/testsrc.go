@@ -0,0 +1,53 @@
+package capture
+
+import (
+	"fmt"
+)
+
+// TestPattern is a virtual camera generated by ffmpeg's lavfi testsrc2, for
+// machines without a webcam
+type TestPattern struct{}
+
+const TestPatternDevice = "Test Pattern"
+
+func (TestPattern) Kind() string {
+	return "testsrc"
+}
+
+func (TestPattern) Devices() []Device {
+	return []Device{{ID: "testsrc", Name: TestPatternDevice, Legacy: TestPatternDevice}}
+}
+
+func (TestPattern) Modes(device string) []Mode {
+	var modes []Mode
+	for _, res := range commonResolutions {
+		if res.width <= 1920 {
+			modes = append(modes, Mode{Width: res.width, Height: res.height, MinFPS: 1, MaxFPS: 60})
+		}
+	}
+	return modes
+}
+
+func (TestPattern) InputArgs(device string, input Input) []string {
+	size := input.Resolution
+	if size == "" {
+		size = "1280x720"
+	}
+	rate := input.FPS
+	if rate <= 0 {
+		rate = 30
+	}
+
+	graph := fmt.Sprintf("testsrc2=size=%s:rate=%d", size, rate)
+
+	//* Burn in the wall clock so frozen or delayed frames are obvious
+	if input.Timestamp {
+		font := ""
+		if timestampFont != "" {
+			font = fmt.Sprintf("fontfile='%s':", timestampFont)
+		}
+		graph += fmt.Sprintf(",drawtext=%stext='%%{localtime}':fontsize=h/16:fontcolor=white:box=1:boxcolor=black@0.6:boxborderw=8:x=16:y=h-th-16", font)
+	}
+
+	return []string{"-f", "lavfi", "-i", graph}
+}
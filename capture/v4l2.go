@@ -0,0 +1,247 @@
+package capture
+
+import (
+	"bytes"
+	"framewave/general"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// V4L2 captures from Linux video devices through ffmpeg's v4l2 input
+type V4L2 struct{}
+
+func (V4L2) Kind() string {
+	return "v4l2"
+}
+
+// Frame sizes offered for devices that only report a stepwise range
+var commonResolutions = []resolution{
+	{320, 240}, {640, 360}, {640, 480}, {800, 600}, {1024, 768},
+	{1280, 720}, {1280, 960}, {1600, 1200}, {1920, 1080}, {2560, 1440}, {3840, 2160},
+}
+
+// . Get video devices
+// Metadata nodes also show up as /dev/video*, so only devices that report at
+// least one capture format are returned. /dev/videoN numbers depend on the
+// order devices were found in, so devices are identified by their udev link
+func (v V4L2) Devices() []Device {
+	paths, _ := filepath.Glob("/dev/video*")
+	sortDevicePaths(paths)
+	links := stableLinks()
+
+	var devices []Device
+	for _, path := range paths {
+		if len(listFormats(path)) == 0 {
+			continue
+		}
+
+		id := path
+		if link, ok := links[path]; ok {
+			id = link
+		}
+		devices = append(devices, Device{ID: id, Name: cardName(path), Legacy: path})
+	}
+	return devices
+}
+
+// Map /dev/videoN to its /dev/v4l/by-id link, or its /dev/v4l/by-path link
+// for devices without a serial number
+func stableLinks() map[string]string {
+	links := make(map[string]string)
+	for _, dir := range []string{"/dev/v4l/by-path", "/dev/v4l/by-id"} {
+		entries, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, link := range entries {
+			if target, err := filepath.EvalSymlinks(link); err == nil {
+				links[target] = link
+			}
+		}
+	}
+	return links
+}
+
+// The name the driver gives the device, e.g. "HD Pro Webcam C920"
+func cardName(path string) string {
+	data, err := os.ReadFile(filepath.Join("/sys/class/video4linux", filepath.Base(path), "name"))
+	if err != nil || strings.TrimSpace(string(data)) == "" {
+		return path
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// . Get device modes
+// ffmpeg doesn't report frame intervals for v4l2 devices, they are taken from
+// v4l2-ctl when it is installed and left at 0 otherwise
+func (V4L2) Modes(device string) []Mode {
+	modes := listFormats(device)
+
+	rates := frameRates(device)
+	for i, mode := range modes {
+		if rate, ok := rates[Mode{Width: mode.Width, Height: mode.Height, Format: mode.Format}]; ok {
+			modes[i].MinFPS = rate.MinFPS
+			modes[i].MaxFPS = rate.MaxFPS
+		}
+	}
+	return modes
+}
+
+func listFormats(device string) []Mode {
+	//* Build command
+	cmd := general.Command(general.FfmpegPath(), "-hide_banner", "-f", "v4l2", "-list_formats", "all", "-i", device)
+
+	//* Create buffer
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Devices that can't capture make ffmpeg fail, they just list no formats
+	_ = cmd.Run()
+	return parseFormats(out.String())
+}
+
+// Parses `-list_formats all` lines such as
+// [video4linux2,v4l2 @ 0x5581] Raw       :     yuyv422 :           YUYV 4:2:2 : 640x480 1280x720
+// [video4linux2,v4l2 @ 0x5581] Compressed:       mjpeg :          Motion-JPEG : {32-1920, 2}x{32-1080, 2}
+func parseFormats(output string) []Mode {
+	// ffmpeg pads "Raw" to the width of "Compressed", which has no space before its colon
+	reLine := regexp.MustCompile(`(?:Raw|Compressed)\s*:\s*(\S+)\s*:.* : (.*)$`)
+	reSize := regexp.MustCompile(`^(\d+)x(\d+)$`)
+	reStepwise := regexp.MustCompile(`\{(\d+)-(\d+), \d+\}x\{(\d+)-(\d+), \d+\}`)
+
+	var modes []Mode
+	for _, line := range strings.Split(output, "\n") {
+		match := reLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		format := match[1]
+		sizes := strings.TrimSpace(match[2])
+
+		//* Stepwise range, offer the common sizes that fit in it
+		if match := reStepwise.FindStringSubmatch(sizes); match != nil {
+			minW, _ := strconv.Atoi(match[1])
+			maxW, _ := strconv.Atoi(match[2])
+			minH, _ := strconv.Atoi(match[3])
+			maxH, _ := strconv.Atoi(match[4])
+			for _, res := range commonResolutions {
+				if res.width >= minW && res.width <= maxW && res.height >= minH && res.height <= maxH {
+					modes = append(modes, Mode{Width: res.width, Height: res.height, Format: format})
+				}
+			}
+			continue
+		}
+
+		//* Discrete sizes
+		for _, size := range strings.Fields(sizes) {
+			if match := reSize.FindStringSubmatch(size); match != nil {
+				width, _ := strconv.Atoi(match[1])
+				height, _ := strconv.Atoi(match[2])
+				modes = append(modes, Mode{Width: width, Height: height, Format: format})
+			}
+		}
+	}
+
+	return modes
+}
+
+// v4l2-ctl names formats by fourcc, ffmpeg by pixel format or codec
+var fourccFormats = map[string]string{
+	"MJPG": "mjpeg",
+	"JPEG": "mjpeg",
+	"YUYV": "yuyv422",
+	"UYVY": "uyvy422",
+	"NV12": "nv12",
+	"YU12": "yuv420p",
+	"RGB3": "rgb24",
+	"GREY": "gray",
+	"H264": "h264",
+}
+
+// . Get frame rates from v4l2-ctl
+// The result is keyed by mode without frame rates
+func frameRates(device string) map[Mode]Mode {
+	v4l2ctl, err := exec.LookPath("v4l2-ctl")
+	if err != nil {
+		return make(map[Mode]Mode)
+	}
+
+	out, err := general.Command(v4l2ctl, "-d", device, "--list-formats-ext").Output()
+	if err != nil {
+		return make(map[Mode]Mode)
+	}
+	return parseFrameRates(string(out))
+}
+
+// Parses `--list-formats-ext` output such as
+//
+//	[0]: 'MJPG' (Motion-JPEG, compressed)
+//		Size: Discrete 1280x720
+//			Interval: Discrete 0.033s (30.000 fps)
+//			Interval: Stepwise 0.033s - 1.000s with step 0.033s (1.000-30.000 fps)
+func parseFrameRates(output string) map[Mode]Mode {
+	rates := make(map[Mode]Mode)
+	reFormat := regexp.MustCompile(`\[\d+\]: '(\w+)'`)
+	reSize := regexp.MustCompile(`Size: Discrete (\d+)x(\d+)`)
+	reRate := regexp.MustCompile(`\(([\d.]+)(?:-([\d.]+))? fps\)`)
+
+	var current Mode
+	for _, line := range strings.Split(output, "\n") {
+		if match := reFormat.FindStringSubmatch(line); match != nil {
+			current = Mode{Format: fourccFormats[match[1]]}
+			continue
+		}
+		if strings.Contains(line, "Size:") {
+			// Stepwise sizes can't be matched to a mode and are skipped
+			current.Width, current.Height = 0, 0
+			if match := reSize.FindStringSubmatch(line); match != nil {
+				current.Width, _ = strconv.Atoi(match[1])
+				current.Height, _ = strconv.Atoi(match[2])
+			}
+			continue
+		}
+		match := reRate.FindStringSubmatch(line)
+		if match == nil || current.Format == "" || current.Width == 0 {
+			continue
+		}
+
+		low, _ := strconv.ParseFloat(match[1], 64)
+		high := low
+		if match[2] != "" {
+			high, _ = strconv.ParseFloat(match[2], 64)
+		}
+		rate, seen := rates[current]
+		if !seen || low < rate.MinFPS {
+			rate.MinFPS = low
+		}
+		if high > rate.MaxFPS {
+			rate.MaxFPS = high
+		}
+		rates[current] = rate
+	}
+	return rates
+}
+
+func (V4L2) InputArgs(device string, input Input) []string {
+	args := []string{"-f", "v4l2"}
+	if input.Format != "" {
+		args = append(args, "-input_format", input.Format, "-framerate", strconv.Itoa(input.FPS))
+	}
+	if input.Resolution != "" {
+		args = append(args, "-video_size", input.Resolution)
+	}
+	return append(args, "-i", device)
+}
+
+// Sort /dev/video10 after /dev/video9
+func sortDevicePaths(paths []string) {
+	number := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(path, "/dev/video"))
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return number(paths[i]) < number(paths[j])
+	})
+}
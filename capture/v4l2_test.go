@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	output := `[video4linux2,v4l2 @ 0x5581] Raw       :     yuyv422 :           YUYV 4:2:2 : 640x480 1280x720
+[video4linux2,v4l2 @ 0x5581] Compressed:       mjpeg :          Motion-JPEG : {32-1920, 2}x{32-1080, 2}
+/dev/video0: Immediate exit requested`
+
+	want := []Mode{
+		{Width: 640, Height: 480, Format: "yuyv422"},
+		{Width: 1280, Height: 720, Format: "yuyv422"},
+		{Width: 320, Height: 240, Format: "mjpeg"},
+		{Width: 640, Height: 360, Format: "mjpeg"},
+		{Width: 640, Height: 480, Format: "mjpeg"},
+		{Width: 800, Height: 600, Format: "mjpeg"},
+		{Width: 1024, Height: 768, Format: "mjpeg"},
+		{Width: 1280, Height: 720, Format: "mjpeg"},
+		{Width: 1280, Height: 960, Format: "mjpeg"},
+		{Width: 1920, Height: 1080, Format: "mjpeg"},
+	}
+	if got := parseFormats(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFormats() = %v, want %v", got, want)
+	}
+}
+
+func TestParseFormatsEmpty(t *testing.T) {
+	if got := parseFormats("/dev/video1: Inappropriate ioctl for device"); len(got) != 0 {
+		t.Errorf("parseFormats() = %v, want none", got)
+	}
+}
+
+func TestParseFrameRates(t *testing.T) {
+	output := `ioctl: VIDIOC_ENUM_FMT
+	Type: Video Capture
+
+	[0]: 'MJPG' (Motion-JPEG, compressed)
+		Size: Discrete 1280x720
+			Interval: Discrete 0.033s (30.000 fps)
+			Interval: Discrete 0.067s (15.000 fps)
+		Size: Discrete 640x480
+			Interval: Stepwise 0.033s - 1.000s with step 0.033s (1.000-30.000 fps)
+	[1]: 'YUYV' (YUYV 4:2:2)
+		Size: Stepwise 32x32 - 1920x1080 with step 2/2
+			Interval: Discrete 0.200s (5.000 fps)
+		Size: Discrete 1280x720
+			Interval: Discrete 0.100s (10.000 fps)
+	[2]: 'XXXX' (Unknown)
+		Size: Discrete 640x480
+			Interval: Discrete 0.033s (30.000 fps)
+`
+
+	want := map[Mode]Mode{
+		{Width: 1280, Height: 720, Format: "mjpeg"}:   {MinFPS: 15, MaxFPS: 30},
+		{Width: 640, Height: 480, Format: "mjpeg"}:    {MinFPS: 1, MaxFPS: 30},
+		{Width: 1280, Height: 720, Format: "yuyv422"}: {MinFPS: 10, MaxFPS: 10},
+	}
+	if got := parseFrameRates(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFrameRates() = %v, want %v", got, want)
+	}
+}
@@ -7,3 +7,4 @@ var Green = color.RGBA{111, 255, 82, 255}
 var Gray = color.RGBA{138, 138, 138, 40}
 var White = color.RGBA{255, 255, 255, 255}
 var OffWhite = color.RGBA{237, 237, 237, 255}
+var Yellow = color.RGBA{255, 204, 0, 255}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"log"
+	"net/http"
+)
+
+// . API server
+// Runs on Config.APIPort for as long as the engine, whether or not cameras are
+// streaming, so monitoring can always reach it. /healthz is left open for load
+// balancers. Anything that changes settings, and the web UI, is refused until
+// a user exists, so the API is never open to remote control without a login.
+
+// Called with e.mu held
+func (e *Engine) startAPIServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.requireUser(e.serveMetrics))
+	mux.HandleFunc("/api/status", e.requireUser(e.serveStatus))
+	mux.HandleFunc("/healthz", e.serveHealth)
+	mux.HandleFunc("/api/cameras", e.requireUser(e.serveCameras))
+	mux.HandleFunc("/api/cameras/", e.requireUser(e.serveCameras))
+	mux.HandleFunc("/api/start", e.requireLogin(e.serveStart))
+	mux.HandleFunc("/api/stop", e.requireLogin(e.serveStop))
+	mux.HandleFunc("/", e.requireLogin(webHandler().ServeHTTP))
+
+	server := &http.Server{
+		Addr:    listenAddr(e.config.APIPort),
+		Handler: mux,
+	}
+	e.apiError = e.serve(server)
+	if e.apiError != nil {
+		log.Println("Can't serve the API on port", e.config.APIPort+":", e.apiError)
+		return
+	}
+	e.apiServer = server
+}
+
+// Called with e.mu held
+func (e *Engine) stopAPIServer() {
+	if e.apiServer == nil {
+		return
+	}
+	e.apiServer.Close()
+	e.apiServer = nil
+}
+
+// requireLogin is requireUser that also refuses everyone while there are no users
+func (e *Engine) requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return e.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if e.refuseAnonymous(w) {
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Refuse a request because there are no users to log in as
+func (e *Engine) refuseAnonymous(w http.ResponseWriter) bool {
+	if !e.users.empty() {
+		return false
+	}
+	http.Error(w, "Add a user in FrameWave to use this remotely", http.StatusForbidden)
+	return true
+}
+
+// APIURL is the address of the web UI and API on this machine
+func (e *Engine) APIURL() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.scheme() + "127.0.0.1:" + e.config.APIPort + "/"
+}
+
+// APIError is why the API server couldn't start, if it couldn't
+func (e *Engine) APIError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.apiError
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"fmt"
+	"framewave/capture"
+	"math"
+	"slices"
+)
+
+// . Capability matrix
+// Every mode a camera reports, with its pixel format and frame rate range.
+// Settings are checked against it so a mode the device can't deliver is
+// refused before ffmpeg is started with it.
+
+// Frame rates offered when a device doesn't report any
+const (
+	defaultMinFPS = 2
+	defaultMaxFPS = 30
+)
+
+// Modes returns the capability matrix of a camera
+func (e *Engine) Modes(id string) []capture.Mode {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]capture.Mode(nil), e.modes[id]...)
+}
+
+// FPSRange returns the frame rates a camera can be set to at a resolution and
+// format. Without a format ffmpeg resamples, so anything up to the fastest
+// format is allowed.
+func (e *Engine) FPSRange(id, resolution, format string) (int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fpsRange(e.modes[id], resolution, format)
+}
+
+func fpsRange(modes []capture.Mode, resolution, format string) (int, int) {
+	minFps, maxFps := math.Inf(1), 0.0
+	for _, mode := range modes {
+		if mode.Resolution() != resolution || (format != "" && mode.Format != format) {
+			continue
+		}
+		if mode.MaxFPS == 0 {
+			continue
+		}
+		minFps = math.Min(minFps, mode.MinFPS)
+		maxFps = math.Max(maxFps, mode.MaxFPS)
+	}
+
+	if maxFps == 0 {
+		return defaultMinFPS, defaultMaxFPS
+	}
+	if format == "" {
+		minFps = defaultMinFPS
+	}
+	return max(int(math.Floor(minFps)), 1), max(int(math.Ceil(maxFps)), 1)
+}
+
+// Validate checks a camera's settings against its capability matrix
+func (e *Engine) Validate(camera CameraSettings) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return validate(camera, e.modes[camera.ID])
+}
+
+func validate(camera CameraSettings, modes []capture.Mode) error {
+	if err := validateLevels(camera); err != nil {
+		return err
+	}
+	if len(modes) == 0 {
+		return nil
+	}
+
+	if !slices.Contains(capture.Resolutions(modes, ""), camera.Resolution) {
+		return fmt.Errorf("%s doesn't support %s", camera.Name, camera.Resolution)
+	}
+	if camera.Format != "" {
+		if _, ok := capture.FindMode(modes, camera.Resolution, camera.Format); !ok {
+			return fmt.Errorf("%s doesn't support %s at %s", camera.Name, camera.Format, camera.Resolution)
+		}
+	}
+
+	minFps, maxFps := fpsRange(modes, camera.Resolution, camera.Format)
+	if camera.FPS < minFps || camera.FPS > maxFps {
+		return fmt.Errorf("%s supports %d-%d FPS at %s, not %d", camera.Name, minFps, maxFps, camera.Resolution, camera.FPS)
+	}
+	if camera.Format != "" && !capture.SupportsFPS(modes, camera.Resolution, camera.Format, camera.FPS) {
+		return fmt.Errorf("%s can't capture %s at %s at %d FPS", camera.Name, camera.Format, camera.Resolution, camera.FPS)
+	}
+	return nil
+}
+
+// The sliders' ranges, anything outside them makes ffmpeg fail
+func validateLevels(camera CameraSettings) error {
+	if camera.Quality < 1 || camera.Quality > 100 {
+		return fmt.Errorf("quality must be 1-100, not %d", camera.Quality)
+	}
+	levels := []struct {
+		name  string
+		value int
+	}{
+		{"brightness", camera.Brightness},
+		{"contrast", camera.Contrast},
+		{"saturation", camera.Saturation},
+		{"sharpness", camera.Sharpness},
+	}
+	for _, level := range levels {
+		if level.value < 0 || level.value > 100 {
+			return fmt.Errorf("%s must be 0-100, not %d", level.name, level.value)
+		}
+	}
+	return nil
+}
+
+// Clamp the frame rate into what the mode supports, or into the nearest of its
+// ranges when it falls between them
+func clampFPS(camera CameraSettings, modes []capture.Mode) int {
+	minFps, maxFps := fpsRange(modes, camera.Resolution, camera.Format)
+	fps := min(max(camera.FPS, minFps), maxFps)
+	if camera.Format == "" || capture.SupportsFPS(modes, camera.Resolution, camera.Format, fps) {
+		return fps
+	}
+
+	nearest := -1
+	for _, mode := range modes {
+		if mode.Resolution() != camera.Resolution || mode.Format != camera.Format || mode.MaxFPS == 0 {
+			continue
+		}
+		low := max(int(math.Floor(mode.MinFPS)), 1)
+		high := max(int(math.Ceil(mode.MaxFPS)), 1)
+		clamped := min(max(fps, low), high)
+		if nearest == -1 || abs(clamped-fps) < abs(nearest-fps) {
+			nearest = clamped
+		}
+	}
+	if nearest == -1 {
+		return fps
+	}
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"framewave/capture"
+	"testing"
+)
+
+// MJPEG at 1280x720 runs at 5-30 or at 60 FPS, nothing in between
+var testModes = []capture.Mode{
+	{Width: 1280, Height: 720, Format: "mjpeg", MinFPS: 5, MaxFPS: 30},
+	{Width: 1280, Height: 720, Format: "mjpeg", MinFPS: 60, MaxFPS: 60},
+	{Width: 1280, Height: 720, Format: "yuyv422", MinFPS: 5, MaxFPS: 10},
+	{Width: 640, Height: 480, Format: "yuyv422", MinFPS: 0.5, MaxFPS: 29.97},
+}
+
+func TestFPSRange(t *testing.T) {
+	tests := []struct {
+		resolution, format string
+		minFps, maxFps     int
+	}{
+		{"1280x720", "mjpeg", 5, 60},
+		{"1280x720", "yuyv422", 5, 10},
+		{"1280x720", "", defaultMinFPS, 60},
+		{"640x480", "yuyv422", 1, 30},
+		{"1920x1080", "", defaultMinFPS, defaultMaxFPS},
+	}
+	for _, test := range tests {
+		minFps, maxFps := fpsRange(testModes, test.resolution, test.format)
+		if minFps != test.minFps || maxFps != test.maxFps {
+			t.Errorf("fpsRange(%s, %q) = %d-%d, want %d-%d", test.resolution, test.format, minFps, maxFps, test.minFps, test.maxFps)
+		}
+	}
+}
+
+func TestClampFPS(t *testing.T) {
+	tests := []struct {
+		format string
+		fps    int
+		want   int
+	}{
+		{"mjpeg", 25, 25},
+		{"mjpeg", 1, 5},
+		{"mjpeg", 90, 60},
+		{"mjpeg", 40, 30},
+		{"mjpeg", 50, 60},
+		{"", 45, 45},
+	}
+	for _, test := range tests {
+		camera := testCamera(func(camera *CameraSettings) { camera.Format, camera.FPS = test.format, test.fps })
+		if got := clampFPS(camera, testModes); got != test.want {
+			t.Errorf("clampFPS(%q, %d) = %d, want %d", test.format, test.fps, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution string
+		format     string
+		fps        int
+		wantErr    bool
+	}{
+		{"valid", "1280x720", "mjpeg", 30, false},
+		{"second range", "1280x720", "mjpeg", 60, false},
+		{"between ranges", "1280x720", "mjpeg", 45, true},
+		{"any format", "1280x720", "", 45, false},
+		{"unknown resolution", "1920x1080", "", 30, true},
+		{"unsupported format", "640x480", "mjpeg", 30, true},
+		{"too fast", "1280x720", "yuyv422", 30, true},
+		{"too slow", "1280x720", "mjpeg", 4, true},
+	}
+	for _, test := range tests {
+		camera := testCamera(func(camera *CameraSettings) {
+			camera.Resolution, camera.Format, camera.FPS = test.resolution, test.format, test.fps
+		})
+		if err := validate(camera, testModes); (err != nil) != test.wantErr {
+			t.Errorf("%s: validate() error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+
+	//* Sources without modes take any mode
+	camera := testCamera(func(camera *CameraSettings) { camera.Resolution = "123x45" })
+	if err := validate(camera, nil); err != nil {
+		t.Errorf("validate() without modes error = %v", err)
+	}
+}
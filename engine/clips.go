@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"framewave/general"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// . Event clips
+// A clipper taps the camera's frameHub and keeps the last PreRollSeconds of
+// frames in memory. When triggered, by motion, the HTTP API or the UI, it
+// starts ffmpeg with those frames and streams it every new one until
+// PostRollSeconds after the last trigger, so a clip is never held in memory.
+// Clips go next to the camera's recordings, so they fall under the same
+// retention policy, and are split every maxClipLength.
+
+const (
+	clipQueueSize = 30
+	maxClipLength = 5 * time.Minute
+)
+
+type timedFrame struct {
+	at    time.Time
+	frame []byte
+}
+
+type clipper struct {
+	engine *Engine
+	camera CameraSettings
+	config Config
+	hub    *frameHub
+	client *hubClient
+
+	mu      sync.Mutex
+	ring    []timedFrame
+	clipEnd time.Time // zero until the first trigger
+}
+
+func newClipper(e *Engine, camera CameraSettings, hub *frameHub) *clipper {
+	return &clipper{
+		engine: e,
+		camera: camera,
+		config: e.config,
+		hub:    hub,
+	}
+}
+
+func (c *clipper) Start() {
+	c.client = c.hub.Tap(clipQueueSize)
+	go c.run()
+}
+
+// Stop drops the buffer, a clip being written is finished with what it has
+func (c *clipper) Stop() {
+	c.hub.Unsubscribe(c.client)
+}
+
+// Trigger starts a clip with the buffered frames, or extends the one being written
+func (c *clipper) Trigger() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clipEnd = time.Now().Add(time.Duration(c.config.PostRollSeconds) * time.Second)
+}
+
+// Only run touches the clip being written, so ffmpeg is fed outside c.mu
+func (c *clipper) run() {
+	preRoll := time.Duration(c.config.PreRollSeconds) * time.Second
+	var clip *clipWriter
+
+	for frame := range c.client.frames {
+		now := time.Now()
+		c.mu.Lock()
+
+		//* Keep only the pre-roll in the ring
+		c.ring = append(c.ring, timedFrame{now, frame})
+		drop := 0
+		for drop < len(c.ring) && now.Sub(c.ring[drop].at) > preRoll {
+			drop++
+		}
+		c.ring = c.ring[drop:]
+
+		triggered := now.Before(c.clipEnd)
+		var buffered []timedFrame
+		if clip == nil && triggered {
+			buffered = append(buffered, c.ring...)
+		}
+		c.mu.Unlock()
+
+		//* Start with the pre-roll, then stream the post-roll
+		if clip == nil {
+			if triggered {
+				clip = c.startClip(buffered, frameRate(buffered, c.camera.FPS))
+			}
+			continue
+		}
+		switch {
+		case !triggered:
+			clip.write(frame)
+			go clip.finish()
+			clip = nil
+		case now.Sub(clip.started) >= maxClipLength:
+			// Still triggered, carry on in the next clip
+			go clip.finish()
+			clip = c.startClip([]timedFrame{{now, frame}}, clip.fps)
+		default:
+			clip.write(frame)
+		}
+	}
+
+	if clip != nil {
+		go clip.finish()
+	}
+}
+
+// The average rate of the buffered frames, or the camera's before there are enough
+func frameRate(frames []timedFrame, fallback int) float64 {
+	if len(frames) >= 2 {
+		if duration := frames[len(frames)-1].at.Sub(frames[0].at).Seconds(); duration > 0 {
+			return float64(len(frames)-1) / duration
+		}
+	}
+	return float64(max(fallback, 1))
+}
+
+// A clip being written by ffmpeg. Once writing fails the rest of the frames
+// are dropped and finish reports why.
+type clipWriter struct {
+	clipper *clipper
+	path    string
+	started time.Time
+	fps     float64
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  bytes.Buffer
+	err     error
+}
+
+// Start ffmpeg on a new clip, with the frames to begin it with
+func (c *clipper) startClip(frames []timedFrame, fps float64) *clipWriter {
+	started := frames[0].at
+	clip := &clipWriter{clipper: c, started: started, fps: fps}
+
+	dir := filepath.Join(c.config.RecordDir, recordingDirName(c.camera.Name))
+	if clip.err = os.MkdirAll(dir, 0755); clip.err != nil {
+		return clip
+	}
+	codec, ext := recordCodec(c.config)
+	clip.path = filepath.Join(dir, "clip_"+started.Format("2006-01-02_15-04-05")+"."+ext)
+
+	args := []string{
+		"-loglevel", "error",
+		"-y",
+		"-framerate", strconv.FormatFloat(fps, 'f', 2, 64),
+		"-f", "mjpeg",
+		"-i", "-",
+	}
+	args = append(args, codec...)
+	args = append(args, clip.path)
+
+	clip.cmd = general.Command(c.engine.ffmpegPath, args...)
+	clip.cmd.Stderr = &clip.stderr
+	if clip.stdin, clip.err = clip.cmd.StdinPipe(); clip.err != nil {
+		return clip
+	}
+	if clip.err = clip.cmd.Start(); clip.err != nil {
+		clip.stdin = nil
+		return clip
+	}
+	for _, frame := range frames {
+		clip.write(frame.frame)
+	}
+	return clip
+}
+
+func (w *clipWriter) write(frame []byte) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.stdin.Write(frame)
+}
+
+// Let ffmpeg finish the file and announce it
+func (w *clipWriter) finish() {
+	c := w.clipper
+	if w.stdin != nil {
+		w.stdin.Close()
+		if err := w.cmd.Wait(); err != nil {
+			w.err = err
+		}
+	}
+	if w.err != nil {
+		log.Println("Can't save clip of", c.camera.Name+":", w.err, strings.TrimSpace(w.stderr.String()))
+		return
+	}
+	c.engine.publish(Event{Type: ClipSaved, Camera: c.camera.ID, Path: w.path})
+}
+
+// . Trigger a clip
+// TriggerClip saves a clip of a camera that keeps a clip buffer
+func (e *Engine) TriggerClip(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	clipper, ok := e.clippers[id]
+	if !ok {
+		return fmt.Errorf("no clip buffer is running for %q", id)
+	}
+	clipper.Trigger()
+	return nil
+}
+
+// Start or stop keeping a clip buffer for a camera to match its settings.
+// Called with e.mu held.
+func (e *Engine) applyClipper(id string) {
+	if clipper, ok := e.clippers[id]; ok {
+		clipper.Stop()
+		delete(e.clippers, id)
+	}
+
+	camera := e.findCamera(id)
+	stream := e.streams[id]
+	if !e.streaming || camera == nil || !camera.Clips || stream == nil || e.offline[id] {
+		return
+	}
+	clipper := newClipper(e, *camera, stream)
+	e.clippers[id] = clipper
+	clipper.Start()
+}
+
+// . POST to /clip to save a clip
+func (e *Engine) serveClip(cameraID string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Use POST to save a clip", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.TriggerClip(cameraID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
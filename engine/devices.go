@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"framewave/capture"
+	"log"
+	"time"
+)
+
+// . Hot-plug
+// Devices are enumerated again every few seconds. New devices are added with
+// their saved settings. A device that disappears is kept as offline while it is
+// enabled, with its stream and server left up, and resumes when it comes back.
+// Disabled devices that disappear are dropped.
+
+const rescanInterval = 5 * time.Second
+
+func (e *Engine) watchDevices() {
+	ticker := time.NewTicker(rescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			e.rescan()
+		}
+	}
+}
+
+// Online reports whether a camera's device is currently plugged in
+func (e *Engine) Online(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.offline[id]
+}
+
+func (e *Engine) rescan() {
+	//* Enumerate without holding the lock, it runs ffmpeg
+	type foundDevice struct {
+		device capture.Device
+		kind   string
+		modes  []capture.Mode
+	}
+	var found []foundDevice
+	for _, source := range capture.Sources() {
+		if source.Kind() == (capture.Network{}).Kind() {
+			continue
+		}
+		for _, device := range source.Devices() {
+			found = append(found, foundDevice{device: device, kind: source.Kind()})
+		}
+	}
+
+	//* Only new devices need their modes listed
+	e.mu.Lock()
+	var unknown []int
+	for i, f := range found {
+		if e.findCamera(f.device.ID) == nil {
+			unknown = append(unknown, i)
+		}
+	}
+	e.mu.Unlock()
+	for _, i := range unknown {
+		found[i].modes = cameraModes(CameraSettings{ID: found[i].device.ID, Source: found[i].kind})
+	}
+
+	e.mu.Lock()
+	present := make(map[string]bool)
+	var changed, resumed []string
+
+	for _, f := range found {
+		present[f.device.ID] = true
+		camera := e.findCamera(f.device.ID)
+
+		switch {
+		case camera == nil:
+			//* New device, or one that was dropped while disabled
+			added := e.newCameraSettings(CameraSettings{ID: f.device.ID, Name: f.device.Name, Source: f.kind}, e.loadSettings(), f.modes)
+			e.cameras = append(e.cameras, added)
+			e.saveSettings(added.ID)
+			log.Println("Found", added.Name)
+			changed = append(changed, added.ID)
+			if added.Enabled {
+				e.applyCamera(added.ID)
+			}
+
+		case e.offline[camera.ID]:
+			//* Known device came back
+			delete(e.offline, camera.ID)
+			log.Println(camera.Name, "is back")
+			changed = append(changed, camera.ID)
+			e.applyCamera(camera.ID)
+			resumed = append(resumed, camera.ID)
+		}
+	}
+
+	for i := 0; i < len(e.cameras); i++ {
+		camera := e.cameras[i]
+		if camera.Source == (capture.Network{}).Kind() || present[camera.ID] || e.offline[camera.ID] {
+			continue
+		}
+
+		// A busy device can fail to list its modes, trust a camera that is delivering frames
+		if sup, ok := e.supervisors[camera.ID]; ok && sup.Status().State == StateRunning {
+			continue
+		}
+
+		changed = append(changed, camera.ID)
+		if camera.Enabled {
+			log.Println(camera.Name, "went offline")
+			e.offline[camera.ID] = true
+			e.applyCamera(camera.ID)
+			continue
+		}
+
+		log.Println(camera.Name, "was removed")
+		e.cameras = append(e.cameras[:i], e.cameras[i+1:]...)
+		delete(e.modes, camera.ID)
+		e.applyCamera(camera.ID)
+		i--
+	}
+	e.mu.Unlock()
+
+	if len(changed) > 0 {
+		e.publish(Event{Type: CamerasChanged})
+	}
+	for _, id := range resumed {
+		e.publish(Event{Type: StateChanged, Camera: id})
+	}
+}
@@ -0,0 +1,912 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"framewave/capture"
+	"framewave/general"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// . Streaming engine
+// Owns the cameras, their ffmpeg supervisors and the HTTP servers. Front ends
+// change settings through its methods and follow it with Subscribe, so the
+// engine never touches any widget.
+
+// CameraSettings are keyed by ID, Name is only shown to the user and can be changed
+type CameraSettings struct {
+	ID         string
+	Name       string
+	Source     string
+	URL        string
+	Resolution string
+	Format     string
+	FPS        int
+	Quality    int
+	Port       string
+	Enabled    bool
+	MaxFPS     int
+	Brightness int
+	Contrast   int
+	Saturation int
+	Sharpness  int
+	Timestamp  bool
+	Record     bool
+	Clips      bool // keep a buffer to save clips of events from
+
+	Timelapse        bool
+	TimelapseSeconds int
+
+	AllowedUsers string // comma separated, every user may watch when empty
+
+	Motion            bool
+	MotionSensitivity int
+	MotionMinArea     int    // percent of the watched pixels
+	MotionZones       string // see ParseMotionZones
+}
+
+type Engine struct {
+	settingsPath string
+	ffmpegPath   string
+
+	done chan struct{}
+
+	mu          sync.Mutex
+	cameras     []CameraSettings
+	offline     map[string]bool
+	modes       map[string][]capture.Mode
+	config      Config
+	streaming   bool
+	streams     map[string]*frameHub
+	supervisors map[string]*supervisor
+	recorders   map[string]*recorder
+	detectors   map[string]*motionDetector
+	clippers    map[string]*clipper
+	timelapsers map[string]*timelapser
+	servers     map[string]*http.Server
+	sharedError error // why the single-port server couldn't start
+	apiServer   *http.Server
+	apiError    error
+	tlsConfig   *tls.Config // loaded on first use
+
+	motionMu     sync.Mutex
+	motionEvents map[string][]MotionEvent
+
+	metricsMu sync.Mutex
+	metrics   map[string]*cameraMetrics
+
+	users *userStore
+
+	subscribersMu  sync.Mutex
+	subscribers    map[int]func(Event)
+	nextSubscriber int
+}
+
+// New loads the settings next to settingsPath and enumerates every camera
+func New(settingsPath string) *Engine {
+	e := &Engine{
+		settingsPath: settingsPath,
+		ffmpegPath:   general.FfmpegPath(),
+		done:         make(chan struct{}),
+		modes:        make(map[string][]capture.Mode),
+		offline:      make(map[string]bool),
+		streams:      make(map[string]*frameHub),
+		supervisors:  make(map[string]*supervisor),
+		recorders:    make(map[string]*recorder),
+		detectors:    make(map[string]*motionDetector),
+		clippers:     make(map[string]*clipper),
+		timelapsers:  make(map[string]*timelapser),
+		motionEvents: make(map[string][]MotionEvent),
+		metrics:      make(map[string]*cameraMetrics),
+		servers:      make(map[string]*http.Server),
+		subscribers:  make(map[int]func(Event)),
+		users:        newUserStore(filepath.Join(filepath.Dir(settingsPath), "users.json")),
+	}
+	e.config = e.loadConfig()
+	e.loadCameras()
+	e.mu.Lock()
+	e.startAPIServer()
+	e.mu.Unlock()
+	go e.watchDevices()
+	go e.watchRecordings()
+	return e
+}
+
+// Close stops watching for devices and recordings and shuts the API server
+// down, call Stop as well to end streaming
+func (e *Engine) Close() {
+	close(e.done)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopAPIServer()
+}
+
+// DefaultSettingsPath is where settings.json lives unless told otherwise
+func DefaultSettingsPath() string {
+	return filepath.Join(general.RoamingDir(), "FrameWave", "settings.json")
+}
+
+func (e *Engine) SettingsPath() string {
+	return e.settingsPath
+}
+
+// . Enumerate every camera and apply its saved settings
+func (e *Engine) loadCameras() {
+	settingsMap := e.loadSettings()
+	migrated := false
+
+	for _, source := range capture.Sources() {
+		for _, device := range source.Devices() {
+			//* Settings saved before IDs were used are keyed by the old device name
+			if _, exists := settingsMap[device.ID]; !exists && device.Legacy != "" {
+				if saved, exists := settingsMap[device.Legacy]; exists && saved.ID == "" {
+					saved.ID = device.ID
+					saved.Name = device.Name
+					delete(settingsMap, device.Legacy)
+					settingsMap[device.ID] = saved
+					migrated = true
+				}
+			}
+
+			camera := CameraSettings{ID: device.ID, Name: device.Name, Source: source.Kind()}
+			e.cameras = append(e.cameras, e.newCameraSettings(camera, settingsMap, cameraModes(camera)))
+		}
+	}
+
+	//. Network cameras are only known from the saved settings
+	var networkCameras []CameraSettings
+	for _, cam := range settingsMap {
+		if cam.Source == (capture.Network{}).Kind() && cam.URL != "" {
+			networkCameras = append(networkCameras, cam)
+		}
+	}
+	for i, cam := range networkCameras {
+		//* Older settings are keyed by the name or by the URL itself
+		if id := networkCameraID(cam.URL); cam.ID != id {
+			key := cam.ID
+			if key == "" {
+				key = cam.Name
+			}
+			delete(settingsMap, key)
+			networkCameras[i].ID = id
+			settingsMap[id] = networkCameras[i]
+			migrated = true
+		}
+	}
+	sort.Slice(networkCameras, func(i, j int) bool {
+		return networkCameras[i].Name < networkCameras[j].Name
+	})
+	for _, cam := range networkCameras {
+		camera := CameraSettings{ID: cam.ID, Name: cam.Name, Source: cam.Source, URL: cam.URL}
+		e.cameras = append(e.cameras, e.newCameraSettings(camera, settingsMap, cameraModes(camera)))
+	}
+
+	if migrated {
+		log.Println("Moved camera settings to device IDs in", e.settingsPath)
+		e.writeSettings(settingsMap)
+	}
+
+	//. Save newly assigned ports so they don't move when devices are enumerated in another order
+	for _, camera := range e.cameras {
+		if settingsMap[camera.ID].Port != camera.Port {
+			e.saveSettings(camera.ID)
+		}
+	}
+}
+
+// . Cameras
+func (e *Engine) Cameras() []CameraSettings {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]CameraSettings(nil), e.cameras...)
+}
+
+func (e *Engine) Camera(id string) (CameraSettings, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if camera := e.findCamera(id); camera != nil {
+		return *camera, true
+	}
+	return CameraSettings{}, false
+}
+
+// Resolutions lists the resolutions a camera can be set to in a format, or in
+// any format when it is empty
+func (e *Engine) Resolutions(id, format string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return capture.Resolutions(e.modes[id], format)
+}
+
+// Formats lists the formats a camera can capture a resolution in, none means
+// the source doesn't let one be picked
+func (e *Engine) Formats(id, resolution string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return capture.Formats(e.modes[id], resolution)
+}
+
+// UpdateCamera saves new settings for a camera and applies them to its stream.
+// The source, URL and max FPS belong to the device and are kept. A new name
+// must be unique and a new port free and not used by another camera. Nothing
+// is changed unless all the settings are valid.
+// Brightness, contrast and saturation are applied to the running ffmpeg, and
+// recording, clips, timelapse and motion detection are changed without
+// touching it. Any other change restarts only this camera.
+func (e *Engine) UpdateCamera(updated CameraSettings) error {
+	e.mu.Lock()
+	camera := e.findCamera(updated.ID)
+	if camera == nil {
+		e.mu.Unlock()
+		return fmt.Errorf("unknown camera %q", updated.ID)
+	}
+	updated.Name = strings.TrimSpace(updated.Name)
+	updated.Source = camera.Source
+	updated.URL = camera.URL
+	updated.MaxFPS = camera.MaxFPS
+	if updated.Name != camera.Name {
+		if err := e.checkName(updated.Name); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+	}
+	if err := validate(updated, e.modes[updated.ID]); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if err := validateMotion(updated); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if err := validateTimelapse(updated); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if updated.Port != camera.Port {
+		if err := e.checkPort(updated.ID, updated.Port); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+	}
+	old := *camera
+	*camera = updated
+	e.saveSettings(updated.ID)
+
+	if !e.streaming || old == updated {
+		e.mu.Unlock()
+		return nil
+	}
+	if onlyTapsChanged(old, updated) {
+		//* Recordings, clips and timelapse frames are saved under the name
+		renamed := old.Name != updated.Name
+		if old.Record != updated.Record || renamed {
+			e.applyRecorder(updated.ID)
+		}
+		if old.Clips != updated.Clips || renamed {
+			e.applyClipper(updated.ID)
+		}
+		e.applyMotion(updated.ID)
+		e.applyTimelapse(updated.ID)
+		e.mu.Unlock()
+		e.publish(Event{Type: StateChanged, Camera: updated.ID})
+		return nil
+	}
+	if sup := e.supervisors[updated.ID]; sup != nil && liveAdjustable(old, updated) {
+		applied, err := sup.Adjust(updated)
+		if applied {
+			e.mu.Unlock()
+			e.publish(Event{Type: StateChanged, Camera: updated.ID})
+			return nil
+		}
+		if err != nil {
+			log.Println("Restarting", updated.Name, "to apply settings:", err)
+		}
+	}
+	e.applyCamera(updated.ID)
+	e.mu.Unlock()
+
+	e.publish(Event{Type: StateChanged, Camera: updated.ID})
+	return nil
+}
+
+// RenameCamera changes the name a camera is shown and served under
+func (e *Engine) RenameCamera(id, name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+	camera := e.findCamera(id)
+	if camera == nil {
+		return fmt.Errorf("unknown camera %q", id)
+	}
+	if name == camera.Name {
+		return nil
+	}
+	if err := e.checkName(name); err != nil {
+		return err
+	}
+
+	camera.Name = name
+	e.saveSettings(id)
+
+	//* Recordings, clips and timelapse frames are saved under the name
+	e.applyRecorder(id)
+	e.applyClipper(id)
+	e.applyTimelapse(id)
+	return nil
+}
+
+// Check that a camera can be renamed to name
+func (e *Engine) checkName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("the name can't be empty")
+	case e.nameTaken(name):
+		return fmt.Errorf("a camera named %q already exists", name)
+	}
+	return nil
+}
+
+// AddNetworkCamera adds a camera that reads from a URL or a video file
+func (e *Engine) AddNetworkCamera(name, streamURL string) (CameraSettings, error) {
+	e.mu.Lock()
+	id := networkCameraID(streamURL)
+	if e.findCamera(id) != nil {
+		e.mu.Unlock()
+		return CameraSettings{}, fmt.Errorf("%s was already added", streamURL)
+	}
+	if e.nameTaken(name) {
+		e.mu.Unlock()
+		return CameraSettings{}, fmt.Errorf("a camera named %q already exists", name)
+	}
+
+	camera := CameraSettings{ID: id, Name: name, Source: (capture.Network{}).Kind(), URL: streamURL}
+	camera = e.newCameraSettings(camera, nil, cameraModes(camera))
+	e.cameras = append(e.cameras, camera)
+	e.saveSettings(camera.ID)
+	e.mu.Unlock()
+
+	e.publish(Event{Type: CamerasChanged})
+	return camera, nil
+}
+
+// The URL can hold a password and IDs are shown in the API, so the ID is a hash of it
+func networkCameraID(streamURL string) string {
+	sum := sha256.Sum256([]byte(streamURL))
+	return "network-" + hex.EncodeToString(sum[:8])
+}
+
+// RemoveCamera forgets a network camera and its settings
+func (e *Engine) RemoveCamera(id string) error {
+	e.mu.Lock()
+	camera := e.findCamera(id)
+	if camera == nil {
+		e.mu.Unlock()
+		return fmt.Errorf("unknown camera %q", id)
+	}
+	if camera.Source != (capture.Network{}).Kind() {
+		e.mu.Unlock()
+		return errors.New("only network cameras can be removed")
+	}
+
+	for i := range e.cameras {
+		if e.cameras[i].ID == id {
+			e.cameras = append(e.cameras[:i], e.cameras[i+1:]...)
+			break
+		}
+	}
+	delete(e.modes, id)
+	e.deleteSettings(id)
+	e.applyCamera(id)
+	e.mu.Unlock()
+
+	e.publish(Event{Type: CamerasChanged})
+	return nil
+}
+
+func (e *Engine) findCamera(id string) *CameraSettings {
+	for i := range e.cameras {
+		if e.cameras[i].ID == id {
+			return &e.cameras[i]
+		}
+	}
+	return nil
+}
+
+func (e *Engine) nameTaken(name string) bool {
+	for _, camera := range e.cameras {
+		if camera.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// . Camera ports
+// Check that a camera can be moved to a port
+func (e *Engine) checkPort(id, port string) error {
+	if err := ValidatePort(port); err != nil {
+		return err
+	}
+	if e.portTaken(id, port) {
+		return fmt.Errorf("port %s is used by another camera", port)
+	}
+	return portFree(port)
+}
+
+func (e *Engine) portTaken(id, port string) bool {
+	if port == e.config.APIPort {
+		return true
+	}
+	for _, camera := range e.cameras {
+		if camera.ID != id && camera.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// The first port from 8080 up that no camera uses
+func (e *Engine) nextPort() string {
+	for port := 8080; ; port++ {
+		if !e.portTaken("", strconv.Itoa(port)) {
+			return strconv.Itoa(port)
+		}
+	}
+}
+
+// . App settings
+func (e *Engine) Config() Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.config
+}
+
+// UpdateConfig saves the app settings and applies them. Only a change to the
+// servers restarts streaming, recording changes restart just the recorders.
+// Server ports must be valid, free and not used by the API or a camera.
+func (e *Engine) UpdateConfig(config Config) error {
+	e.mu.Lock()
+	if config == e.config {
+		e.mu.Unlock()
+		return nil
+	}
+	old := e.config
+	if err := e.checkServerPorts(old, config); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	e.config = config
+	e.saveConfig()
+
+	if tlsChanged(old, config) {
+		e.tlsConfig = nil
+	}
+	if old.APIPort != config.APIPort || tlsChanged(old, config) {
+		e.stopAPIServer()
+		e.startAPIServer()
+	}
+	if recordingChanged(old, config) {
+		for id := range e.streams {
+			e.applyRecorder(id)
+			e.applyClipper(id)
+			e.applyTimelapse(id)
+		}
+	}
+	e.mu.Unlock()
+
+	if serversChanged(old, config) {
+		e.Restart()
+	}
+	return nil
+}
+
+// Check the ports of the single-port server and the API. Cameras only bind
+// their own ports outside single-port mode, so the server may share a port
+// with one. Called with e.mu held.
+func (e *Engine) checkServerPorts(old, config Config) error {
+	for _, port := range []string{config.ServerPort, config.APIPort} {
+		if err := ValidatePort(port); err != nil {
+			return err
+		}
+	}
+	if config.ServerPort == config.APIPort {
+		return fmt.Errorf("the server and the API can't both use port %s", config.APIPort)
+	}
+	for _, camera := range e.cameras {
+		if camera.Port == config.APIPort {
+			return fmt.Errorf("port %s is used by %s", config.APIPort, camera.Name)
+		}
+	}
+
+	if config.APIPort != old.APIPort {
+		if err := portFree(config.APIPort); err != nil {
+			return err
+		}
+	}
+	//* A camera of ours holding the port lets go of it when streaming restarts
+	moved := config.ServerPort != old.ServerPort || !old.SinglePort
+	ours := e.streaming && !old.SinglePort && e.portTaken("", config.ServerPort)
+	if config.SinglePort && moved && !ours {
+		if err := portFree(config.ServerPort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// . Start streaming every enabled camera
+// Does nothing if streaming already
+func (e *Engine) Start() {
+	e.mu.Lock()
+	if e.streaming {
+		e.mu.Unlock()
+		return
+	}
+	e.streaming = true
+	general.KillProcByName(filepath.Base(e.ffmpegPath))
+
+	// All cameras share one server in single-port mode
+	e.sharedError = nil
+	if e.config.SinglePort {
+		if err := e.startSharedServer(); err != nil {
+			log.Println("Can't serve on port", e.config.ServerPort+":", err)
+			e.sharedError = err
+		}
+	}
+
+	for _, camera := range e.cameras {
+		if camera.Enabled {
+			e.applyCamera(camera.ID)
+		}
+	}
+	e.mu.Unlock()
+
+	e.publish(Event{Type: StreamingChanged})
+}
+
+// . Stop streaming
+// The returned channel is closed once every server has shut down, or at once
+// if not streaming
+func (e *Engine) Stop() <-chan struct{} {
+	e.mu.Lock()
+	if !e.streaming {
+		e.mu.Unlock()
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	e.streaming = false
+
+	// Stop the supervisors first so none of them restarts ffmpeg
+	for id, sup := range e.supervisors {
+		sup.Stop()
+		delete(e.supervisors, id)
+	}
+	var recordings []<-chan struct{}
+	for id, rec := range e.recorders {
+		recordings = append(recordings, rec.Stop())
+		delete(e.recorders, id)
+	}
+	for id, detector := range e.detectors {
+		detector.Stop()
+		delete(e.detectors, id)
+	}
+	for id, clipper := range e.clippers {
+		clipper.Stop()
+		delete(e.clippers, id)
+	}
+	for id, timelapser := range e.timelapsers {
+		timelapser.Stop()
+		delete(e.timelapsers, id)
+	}
+
+	// Detach the running streams and servers so a following Start gets fresh ones
+	oldStreams := e.streams
+	e.streams = make(map[string]*frameHub)
+	oldServers := e.servers
+	e.servers = make(map[string]*http.Server)
+	e.mu.Unlock()
+
+	e.publish(Event{Type: StreamingChanged})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, hub := range oldStreams {
+			hub.Close()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, serv := range oldServers {
+			serv.Shutdown(ctx)
+		}
+		for _, recording := range recordings {
+			select {
+			case <-recording:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return done
+}
+
+// . Restart a single camera with its current settings
+// Its frameHub and server are kept, so viewers stay connected while ffmpeg
+// restarts. A camera that was disabled or removed is torn down instead.
+// Called with e.mu held.
+func (e *Engine) applyCamera(id string) {
+	if !e.streaming {
+		return
+	}
+
+	if sup, ok := e.supervisors[id]; ok {
+		sup.Stop()
+		delete(e.supervisors, id)
+	}
+	defer e.applyRecorder(id)
+	defer e.applyMotion(id)
+	defer e.applyClipper(id)
+	defer e.applyTimelapse(id)
+
+	camera := e.findCamera(id)
+	if e.offline[id] && camera != nil && camera.Enabled {
+		// Keep the stream and server so viewers are back when the device is
+		return
+	}
+	if camera == nil || !camera.Enabled {
+		if hub, ok := e.streams[id]; ok {
+			hub.Close()
+			delete(e.streams, id)
+		}
+		if server, ok := e.servers[id]; ok {
+			server.Close()
+			delete(e.servers, id)
+		}
+		return
+	}
+
+	//* Bind the camera's port first, there is no point capturing a stream nobody can reach
+	serverErr := e.sharedError
+	if !e.config.SinglePort {
+		server, ok := e.servers[id]
+		if ok && server.Addr != listenAddr(camera.Port) {
+			server.Close()
+			delete(e.servers, id)
+			ok = false
+		}
+		if !ok {
+			serverErr = e.startCameraServer(*camera)
+		}
+	}
+	if serverErr != nil {
+		if hub, ok := e.streams[id]; ok {
+			hub.Close()
+			delete(e.streams, id)
+		}
+		log.Println("Can't serve", camera.Name+":", serverErr)
+		sup := newSupervisor(e, *camera, e.modes[id], nil)
+		sup.fail(fmt.Errorf("can't serve the stream: %w", serverErr))
+		e.supervisors[id] = sup
+		return
+	}
+
+	stream, ok := e.streams[id]
+	if !ok {
+		stream = newFrameHub(e.metricsFor(id))
+		e.streams[id] = stream
+	}
+
+	sup := newSupervisor(e, *camera, e.modes[id], stream)
+	e.supervisors[id] = sup
+	sup.Start()
+}
+
+// Start or stop recording a camera to match its settings, a new recorder
+// starts a new segment. Called with e.mu held.
+func (e *Engine) applyRecorder(id string) {
+	if rec, ok := e.recorders[id]; ok {
+		rec.Stop()
+		delete(e.recorders, id)
+	}
+
+	camera := e.findCamera(id)
+	stream := e.streams[id]
+	if !e.streaming || camera == nil || !camera.Record || stream == nil || e.offline[id] {
+		return
+	}
+	rec := newRecorder(e, *camera, stream)
+	e.recorders[id] = rec
+	rec.Start()
+}
+
+// Start or stop detecting motion on a camera to match its settings. Called
+// with e.mu held.
+func (e *Engine) applyMotion(id string) {
+	if detector, ok := e.detectors[id]; ok {
+		detector.Stop()
+		delete(e.detectors, id)
+	}
+
+	camera := e.findCamera(id)
+	stream := e.streams[id]
+	if !e.streaming || camera == nil || !camera.Motion || stream == nil || e.offline[id] {
+		return
+	}
+	detector := newMotionDetector(e, *camera, stream)
+	e.detectors[id] = detector
+	detector.Start()
+}
+
+// Recording, clips, timelapse and motion detection only read the camera's
+// frames, and the name and allowed users are looked up on every request.
+// Changing them leaves ffmpeg running.
+func onlyTapsChanged(old, updated CameraSettings) bool {
+	old.Name = updated.Name
+	old.AllowedUsers = updated.AllowedUsers
+	old.Record = updated.Record
+	old.Clips = updated.Clips
+	old.Timelapse = updated.Timelapse
+	old.TimelapseSeconds = updated.TimelapseSeconds
+	old.Motion = updated.Motion
+	old.MotionSensitivity = updated.MotionSensitivity
+	old.MotionMinArea = updated.MotionMinArea
+	old.MotionZones = updated.MotionZones
+	return old == updated
+}
+
+// Restart applies changed settings to running streams
+func (e *Engine) Restart() {
+	if e.Streaming() {
+		<-e.Stop()
+		e.Start()
+	}
+}
+
+func (e *Engine) Streaming() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.streaming
+}
+
+// Running reports whether a camera is currently being streamed
+func (e *Engine) Running(id string) bool {
+	return e.stream(id) != nil
+}
+
+func (e *Engine) stream(id string) *frameHub {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.streams[id]
+}
+
+// . Capture status
+type CameraStatus struct {
+	State        State
+	LastError    string
+	Restarts     int
+	Started      time.Time
+	RunningSince time.Time // zero unless frames are coming in
+	Recording    bool
+	Motion       bool // motion is being detected right now
+}
+
+// Status reports the capture state of a running camera
+func (e *Engine) Status(id string) (CameraStatus, bool) {
+	e.mu.Lock()
+	sup := e.supervisors[id]
+	offline := e.offline[id] && e.streaming
+	_, recording := e.recorders[id]
+	e.mu.Unlock()
+
+	if offline {
+		return CameraStatus{State: StateOffline}, true
+	}
+	if sup == nil {
+		return CameraStatus{}, false
+	}
+	status := sup.Status()
+	status.Recording = recording
+	if events := e.MotionEvents(id); len(events) > 0 {
+		status.Motion = events[len(events)-1].End == nil
+	}
+	return status, true
+}
+
+// Fill in saved settings, or the defaults for a camera seen for the first time,
+// and fit them to the device's modes
+func (e *Engine) newCameraSettings(camera CameraSettings, settingsMap map[string]CameraSettings, modes []capture.Mode) CameraSettings {
+	camera.FPS = 30
+	camera.Quality = 100
+	camera.Brightness = 50
+	camera.Contrast = 50
+	camera.Saturation = 50
+	camera.Sharpness = 50
+	camera.MotionSensitivity = 50
+	camera.MotionMinArea = 2
+	camera.TimelapseSeconds = 60
+
+	if saved, exists := settingsMap[camera.ID]; exists {
+		if saved.Name != "" {
+			camera.Name = saved.Name
+		}
+		if ValidatePort(saved.Port) == nil && !e.portTaken(camera.ID, saved.Port) {
+			camera.Port = saved.Port
+		}
+		camera.Enabled = saved.Enabled
+		camera.Resolution = saved.Resolution
+		camera.Format = saved.Format
+		camera.FPS = saved.FPS
+		if validateLevels(saved) == nil {
+			camera.Quality = saved.Quality
+			camera.Brightness = saved.Brightness
+			camera.Contrast = saved.Contrast
+			camera.Saturation = saved.Saturation
+			camera.Sharpness = saved.Sharpness
+		}
+		camera.Timestamp = saved.Timestamp
+		camera.Record = saved.Record
+		camera.Clips = saved.Clips
+		camera.AllowedUsers = saved.AllowedUsers
+		camera.Timelapse = saved.Timelapse
+		if validateTimelapse(saved) == nil {
+			camera.TimelapseSeconds = saved.TimelapseSeconds
+		}
+		camera.Motion = saved.Motion
+		if validateMotion(saved) == nil {
+			camera.MotionSensitivity = saved.MotionSensitivity
+			camera.MotionMinArea = saved.MotionMinArea
+			camera.MotionZones = saved.MotionZones
+		}
+	}
+
+	e.modes[camera.ID] = modes
+	camera.MaxFPS = capture.MaxFPS(modes)
+	resolutions := capture.Resolutions(modes, "")
+	if !slices.Contains(resolutions, camera.Resolution) && len(resolutions) > 0 {
+		camera.Resolution = resolutions[0]
+	}
+	if !slices.Contains(capture.Formats(modes, camera.Resolution), camera.Format) {
+		camera.Format = ""
+	}
+	camera.FPS = clampFPS(camera, modes)
+
+	//* Identical webcams report the same name
+	base := camera.Name
+	for n := 2; e.nameTaken(camera.Name); n++ {
+		camera.Name = fmt.Sprintf("%s (%d)", base, n)
+	}
+
+	if camera.Port == "" {
+		camera.Port = e.nextPort()
+	}
+	return camera
+}
+
+// The modes a camera's device supports, this can run ffmpeg so don't hold e.mu
+func cameraModes(camera CameraSettings) []capture.Mode {
+	return capture.ByKind(camera.Source).Modes(cameraDevice(camera))
+}
+
+// . Network cameras are opened by URL, everything else by ID
+func cameraDevice(camera CameraSettings) string {
+	if camera.URL != "" {
+		return camera.URL
+	}
+	return camera.ID
+}
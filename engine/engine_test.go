@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckServerPorts(t *testing.T) {
+	e := &Engine{cameras: []CameraSettings{testCamera(func(camera *CameraSettings) { camera.Port = "8081" })}}
+	old := Config{ServerPort: "8080", APIPort: "8079"}
+
+	tests := []struct {
+		name                string
+		serverPort, apiPort string
+		wantErr             bool
+	}{
+		{"invalid", "80800", "8079", true},
+		{"same ports", "8090", "8090", true},
+		{"api on a camera", "8080", "8081", true},
+	}
+	for _, test := range tests {
+		config := old
+		config.ServerPort, config.APIPort = test.serverPort, test.apiPort
+		if err := e.checkServerPorts(old, config); (err != nil) != test.wantErr {
+			t.Errorf("%s: checkServerPorts() error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestStartStopTwice(t *testing.T) {
+	//* Streaming already, so Start must leave it as it is
+	e := &Engine{streaming: true}
+	e.Start()
+	if !e.Streaming() {
+		t.Error("Streaming() after a second Start = false, want true")
+	}
+
+	e = &Engine{}
+	select {
+	case <-e.Stop():
+	case <-time.After(time.Second):
+		t.Error("Stop() while stopped didn't return a closed channel")
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+// . Events
+// Subscribers are called from the engine's goroutines and must not block
+
+type EventType int
+
+const (
+	StreamingChanged EventType = iota // streaming was started or stopped
+	FrameReceived                     // Frame holds a new JPEG from Camera
+	FPSChanged                        // FPS holds the rate ffmpeg reports for Camera
+	StateChanged                      // the capture state of Camera changed
+	CamerasChanged                    // cameras were added, removed, or went on or offline
+	MotionStarted                     // Motion holds the event that started on Camera
+	MotionEnded                       // Motion holds the event that ended on Camera
+	ClipSaved                         // Path holds a clip saved from Camera
+	SettingsChanged                   // the settings of Camera were changed through the API
+)
+
+type Event struct {
+	Type EventType
+	// Camera is the ID of the camera the event is about
+	Camera string
+	Frame  []byte
+	FPS    int
+	Motion MotionEvent
+	Path   string
+}
+
+// Subscribe calls handler for every event until the returned func is called
+func (e *Engine) Subscribe(handler func(Event)) func() {
+	e.subscribersMu.Lock()
+	defer e.subscribersMu.Unlock()
+
+	id := e.nextSubscriber
+	e.nextSubscriber++
+	e.subscribers[id] = handler
+
+	return func() {
+		e.subscribersMu.Lock()
+		defer e.subscribersMu.Unlock()
+		delete(e.subscribers, id)
+	}
+}
+
+func (e *Engine) publish(event Event) {
+	e.subscribersMu.Lock()
+	handlers := make([]func(Event), 0, len(e.subscribers))
+	for _, handler := range e.subscribers {
+		handlers = append(handlers, handler)
+	}
+	e.subscribersMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"framewave/capture"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Read buffer used when the resolution can't be parsed, e.g. network cameras
+const minBufferSize = 64 * 1024
+
+// . FFMPEG arguments for a camera
+func ffmpegArgs(camera CameraSettings, modes []capture.Mode) []string {
+	input := capture.Input{
+		Resolution: camera.Resolution,
+		FPS:        camera.FPS,
+		Timestamp:  camera.Timestamp,
+	}
+
+	//* Only ask for a format when the device can deliver it at this frame rate
+	if capture.SupportsFPS(modes, camera.Resolution, camera.Format, camera.FPS) {
+		input.Format = camera.Format
+	}
+	args := capture.ByKind(camera.Source).InputArgs(cameraDevice(camera), input)
+
+	//* Frames that are already JPEG and need no filters are passed through as is
+	if input.Format == capture.FormatMJPEG && passthrough(camera) {
+		return append(args,
+			"-c:v", "copy",
+			"-loglevel", "verbose",
+			"-f", "mjpeg", "-",
+		)
+	}
+
+	return append(args,
+		"-pix_fmt", "yuv420p",
+		"-color_range", "2",
+		"-vf", fmt.Sprintf("scale=in_range=pc:out_range=pc,scale=%s,fps=%v,%s=brightness=%.2f:contrast=%.2f:saturation=%.2f,unsharp=luma_msize_x=3:luma_msize_y=3:luma_amount=%.2f", camera.Resolution, camera.FPS, eqFilter, brightness(camera), contrast(camera), saturation(camera), (float64(camera.Sharpness)-50.0)/50.0),
+		"-c:v", "mjpeg",
+		"-loglevel", "verbose",
+		"-q:v", strconv.Itoa(2+(100-camera.Quality)*(31-2)/(100-1)),
+		"-f", "mjpeg", "-",
+	)
+}
+
+// . Live adjustments
+// The eq filter is named so it can be sent commands while ffmpeg runs. unsharp
+// doesn't take commands, so sharpness changes still restart the camera.
+const eqFilter = "eq@adjust"
+
+func brightness(camera CameraSettings) float64 {
+	return (float64(camera.Brightness) - 50.0) / 50.0
+}
+
+func contrast(camera CameraSettings) float64 {
+	return float64(camera.Contrast) / 50.0
+}
+
+func saturation(camera CameraSettings) float64 {
+	return float64(camera.Saturation) / 50.0
+}
+
+// Keystrokes for ffmpeg's command prompt: "c", then "target time command argument"
+func adjustCommands(camera CameraSettings) string {
+	return fmt.Sprintf("c%s -1 brightness %.2f\nc%s -1 contrast %.2f\nc%s -1 saturation %.2f\n",
+		eqFilter, brightness(camera), eqFilter, contrast(camera), eqFilter, saturation(camera))
+}
+
+// Whether MJPEG from the device can be sent without re-encoding, i.e. no
+// adjustments are applied and the quality is left at the maximum
+func passthrough(camera CameraSettings) bool {
+	return camera.Format == capture.FormatMJPEG &&
+		camera.Quality == 100 &&
+		!camera.Timestamp &&
+		camera.Brightness == 50 &&
+		camera.Contrast == 50 &&
+		camera.Saturation == 50 &&
+		camera.Sharpness == 50
+}
+
+// Whether the only differences between two settings can be applied with
+// adjustCommands. Passthrough has no filters to send commands to.
+func liveAdjustable(old, updated CameraSettings) bool {
+	if passthrough(old) || passthrough(updated) {
+		return false
+	}
+	old.Brightness = updated.Brightness
+	old.Contrast = updated.Contrast
+	old.Saturation = updated.Saturation
+	return old == updated
+}
+
+func processFrames(ffmpegOut io.ReadCloser, sup *supervisor, camera CameraSettings) {
+	jpegEnd := []byte{0xFF, 0xD9}
+	var buffer []byte
+	var bufferSize = calculateBufferSize(camera.Resolution) * 5
+
+	readBuffer := make([]byte, bufferSize)
+
+	for {
+		n, err := ffmpegOut.Read(readBuffer)
+		if err != nil {
+			return
+		}
+		buffer = append(buffer, readBuffer[:n]...)
+
+		for {
+			idx := bytes.Index(buffer, jpegEnd)
+			if idx == -1 {
+				break
+			}
+
+			frame := buffer[:idx+2]
+
+			sup.engine.publish(Event{Type: FrameReceived, Camera: camera.ID, Frame: frame})
+			sup.frameReceived()
+			sup.metrics.frame(len(frame))
+			sup.stream.Publish(frame)
+
+			buffer = buffer[idx+2:]
+		}
+
+		if len(buffer) > bufferSize {
+			buffer = buffer[len(buffer)-bufferSize:]
+		}
+	}
+}
+
+// Returns the last line that wasn't a progress update, which is usually the
+// reason ffmpeg exited
+func monitorFPS(stderrReader io.ReadCloser, sup *supervisor) string {
+	defer stderrReader.Close()
+
+	reFPS := regexp.MustCompile(`fps=\s*(\d+)`)
+	var lastLine string
+
+	scanner := bufio.NewScanner(stderrReader)
+	scanner.Split(scanLinesOrCR)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		matches := reFPS.FindStringSubmatch(line)
+		if len(matches) > 1 {
+			intFPS, _ := strconv.Atoi(matches[1])
+			sup.metrics.setFPS(intFPS)
+			sup.engine.publish(Event{Type: FPSChanged, Camera: sup.id, FPS: intFPS})
+		} else if line != "" {
+			lastLine = line
+		}
+	}
+	return lastLine
+}
+
+// ffmpeg ends progress lines with a carriage return instead of a newline
+func scanLinesOrCR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func calculateBufferSize(resolution string) int {
+	re := regexp.MustCompile(`(\d+)x(\d+)`)
+	matches := re.FindStringSubmatch(resolution)
+	if len(matches) < 3 {
+		return minBufferSize
+	}
+
+	width, _ := strconv.Atoi(matches[1])
+	height, _ := strconv.Atoi(matches[2])
+	uncompressedSize := width * height * 24 / 8
+	estimatedJPEGSize := uncompressedSize / 20
+	return max(estimatedJPEGSize+int(0.2*float64(estimatedJPEGSize)), minBufferSize)
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"framewave/capture"
+	"testing"
+)
+
+// testCamera is a valid MJPEG camera with untouched levels, changed by change
+func testCamera(change func(camera *CameraSettings)) CameraSettings {
+	camera := CameraSettings{
+		ID:         "testsrc",
+		Name:       "Webcam",
+		Resolution: "1280x720",
+		Format:     capture.FormatMJPEG,
+		FPS:        30,
+		Quality:    100,
+		Brightness: 50,
+		Contrast:   50,
+		Saturation: 50,
+		Sharpness:  50,
+
+		TimelapseSeconds:  60,
+		MotionSensitivity: 50,
+		MotionMinArea:     2,
+	}
+	if change != nil {
+		change(&camera)
+	}
+	return camera
+}
+
+func TestLiveAdjustable(t *testing.T) {
+	reencoded := func(camera *CameraSettings) { camera.Quality = 90 }
+	old := testCamera(reencoded)
+
+	tests := []struct {
+		name    string
+		updated CameraSettings
+		want    bool
+	}{
+		{"nothing", old, true},
+		{"levels", testCamera(func(camera *CameraSettings) {
+			reencoded(camera)
+			camera.Brightness, camera.Contrast, camera.Saturation = 10, 20, 30
+		}), true},
+		{"sharpness", testCamera(func(camera *CameraSettings) {
+			reencoded(camera)
+			camera.Sharpness = 60
+		}), false},
+		{"resolution", testCamera(func(camera *CameraSettings) {
+			reencoded(camera)
+			camera.Resolution = "640x480"
+		}), false},
+		{"into passthrough", testCamera(nil), false},
+	}
+	for _, test := range tests {
+		if got := liveAdjustable(old, test.updated); got != test.want {
+			t.Errorf("%s: liveAdjustable() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	tests := []struct {
+		name   string
+		camera CameraSettings
+		want   bool
+	}{
+		{"untouched mjpeg", testCamera(nil), true},
+		{"other fps", testCamera(func(camera *CameraSettings) { camera.FPS = 15 }), true},
+		{"raw format", testCamera(func(camera *CameraSettings) { camera.Format = "yuyv422" }), false},
+		{"any format", testCamera(func(camera *CameraSettings) { camera.Format = "" }), false},
+		{"lower quality", testCamera(func(camera *CameraSettings) { camera.Quality = 90 }), false},
+		{"timestamp", testCamera(func(camera *CameraSettings) { camera.Timestamp = true }), false},
+		{"brightness", testCamera(func(camera *CameraSettings) { camera.Brightness = 60 }), false},
+		{"sharpness", testCamera(func(camera *CameraSettings) { camera.Sharpness = 40 }), false},
+	}
+	for _, test := range tests {
+		if got := passthrough(test.camera); got != test.want {
+			t.Errorf("%s: passthrough() = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	//* Passthrough has no filter to adjust live
+	if liveAdjustable(testCamera(nil), testCamera(func(camera *CameraSettings) { camera.Brightness = 60 })) {
+		t.Error("liveAdjustable() from passthrough = true, want false")
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// . Frame broadcasting
+// processFrames publishes every JPEG into the camera's frameHub, and each HTTP
+// client reads from its own small queue. A client that falls behind has its
+// oldest queued frame dropped so it always gets the newest one, and a client
+// that stops reading altogether is evicted instead of holding frames back.
+// Taps are clients inside FrameWave, such as the recorder, that get a longer
+// queue and are never evicted.
+
+const (
+	clientQueueSize   = 2
+	slowClientTimeout = 5 * time.Second
+)
+
+type frameHub struct {
+	metrics *cameraMetrics
+
+	mu      sync.Mutex
+	clients map[*hubClient]struct{}
+	latest  []byte
+	closed  bool
+}
+
+type hubClient struct {
+	frames    chan []byte
+	fullSince time.Time
+	tap       bool
+}
+
+func newFrameHub(metrics *cameraMetrics) *frameHub {
+	return &frameHub{metrics: metrics, clients: make(map[*hubClient]struct{})}
+}
+
+// Subscribe registers a new client. The client's channel is closed when the
+// hub is closed or the client is evicted for being too slow.
+func (h *frameHub) Subscribe() *hubClient {
+	return h.subscribe(&hubClient{frames: make(chan []byte, clientQueueSize)})
+}
+
+// Tap registers a client that is never evicted, its channel is only closed by
+// Unsubscribe or when the hub is closed
+func (h *frameHub) Tap(queueSize int) *hubClient {
+	return h.subscribe(&hubClient{frames: make(chan []byte, queueSize), tap: true})
+}
+
+func (h *frameHub) subscribe(client *hubClient) *hubClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(client.frames)
+		return client
+	}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+func (h *frameHub) Unsubscribe(client *hubClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.frames)
+	}
+}
+
+// Publish hands the frame to every client without ever blocking the caller.
+func (h *frameHub) Publish(frame []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latest = frame
+	now := time.Now()
+	for client := range h.clients {
+		select {
+		case client.frames <- frame:
+			client.fullSince = time.Time{}
+			continue
+		default:
+		}
+
+		//* Queue is full, evict the client if it has been stuck for too long
+		if client.fullSince.IsZero() {
+			client.fullSince = now
+		} else if now.Sub(client.fullSince) > slowClientTimeout && !client.tap {
+			delete(h.clients, client)
+			close(client.frames)
+			continue
+		}
+
+		//* Latest frame wins
+		select {
+		case <-client.frames:
+			if !client.tap {
+				h.metrics.dropped()
+			}
+		default:
+		}
+		select {
+		case client.frames <- frame:
+		default:
+		}
+	}
+}
+
+// Latest returns the most recent complete frame, or nil before the first one
+func (h *frameHub) Latest() []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.latest
+}
+
+// Close disconnects every client. Publishing to a closed hub is a no-op.
+func (h *frameHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.frames)
+	}
+}
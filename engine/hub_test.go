@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameHubKeepsNewestFrames(t *testing.T) {
+	metrics := &cameraMetrics{}
+	hub := newFrameHub(metrics)
+	client := hub.Subscribe()
+
+	hub.Publish([]byte("1"))
+	hub.Publish([]byte("2"))
+	hub.Publish([]byte("3"))
+
+	for _, want := range []string{"2", "3"} {
+		if got := string(<-client.frames); got != want {
+			t.Errorf("got frame %q, want %q", got, want)
+		}
+	}
+	if dropped := metrics.values().Dropped; dropped != 1 {
+		t.Errorf("dropped %d frames, want 1", dropped)
+	}
+	if got := string(hub.Latest()); got != "3" {
+		t.Errorf("Latest() = %q, want %q", got, "3")
+	}
+}
+
+func TestFrameHubEvictsStuckClients(t *testing.T) {
+	hub := newFrameHub(nil)
+	client := hub.Subscribe()
+	tap := hub.Tap(1)
+
+	hub.Publish([]byte("1"))
+	hub.Publish([]byte("2"))
+	hub.Publish([]byte("3"))
+
+	//* Pretend neither has read anything for longer than the timeout
+	hub.mu.Lock()
+	client.fullSince = time.Now().Add(-slowClientTimeout - time.Second)
+	tap.fullSince = client.fullSince
+	hub.mu.Unlock()
+	hub.Publish([]byte("4"))
+
+	hub.mu.Lock()
+	_, clientKept := hub.clients[client]
+	_, tapKept := hub.clients[tap]
+	hub.mu.Unlock()
+	if clientKept {
+		t.Error("stuck client wasn't evicted")
+	}
+	if !tapKept {
+		t.Error("stuck tap was evicted")
+	}
+	if got := string(<-tap.frames); got != "4" {
+		t.Errorf("tap got frame %q, want %q", got, "4")
+	}
+}
+
+func TestFrameHubClose(t *testing.T) {
+	hub := newFrameHub(nil)
+	client := hub.Subscribe()
+	hub.Close()
+	hub.Publish([]byte("1"))
+
+	if _, ok := <-client.frames; ok {
+		t.Error("client still open after Close")
+	}
+	if _, ok := <-hub.Subscribe().frames; ok {
+		t.Error("client subscribed after Close is open")
+	}
+}
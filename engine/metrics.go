@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// . Metrics
+// Every camera has counters that outlive its supervisors and frameHubs, so
+// they only ever go up while the app runs. /metrics serves them in the
+// Prometheus text format.
+
+// Weight of the newest frame in the average frame size
+const frameSizeSmoothing = 0.05
+
+type metricValues struct {
+	FPS          int // as reported by ffmpeg, 0 while it isn't running
+	Frames       uint64
+	FrameBytes   uint64
+	AvgFrameSize float64 // of recent frames
+	Dropped      uint64  // frames a viewer missed because it fell behind
+	SentBytes    uint64
+	Clients      int
+	Restarts     uint64
+	LastFrame    time.Time
+}
+
+// The methods do nothing on a nil *cameraMetrics
+type cameraMetrics struct {
+	mu sync.Mutex
+	v  metricValues
+}
+
+func (m *cameraMetrics) update(change func(v *metricValues)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(&m.v)
+}
+
+func (m *cameraMetrics) values() metricValues {
+	if m == nil {
+		return metricValues{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.v
+}
+
+func (m *cameraMetrics) frame(size int) {
+	m.update(func(v *metricValues) {
+		v.Frames++
+		v.LastFrame = time.Now()
+		v.FrameBytes += uint64(size)
+		if v.AvgFrameSize == 0 {
+			v.AvgFrameSize = float64(size)
+		} else {
+			v.AvgFrameSize += (float64(size) - v.AvgFrameSize) * frameSizeSmoothing
+		}
+	})
+}
+
+func (m *cameraMetrics) setFPS(fps int) {
+	m.update(func(v *metricValues) { v.FPS = fps })
+}
+
+func (m *cameraMetrics) dropped() {
+	m.update(func(v *metricValues) { v.Dropped++ })
+}
+
+func (m *cameraMetrics) sent(n int64) {
+	m.update(func(v *metricValues) { v.SentBytes += uint64(n) })
+}
+
+func (m *cameraMetrics) clientConnected(delta int) {
+	m.update(func(v *metricValues) { v.Clients += delta })
+}
+
+func (m *cameraMetrics) restarted() {
+	m.update(func(v *metricValues) { v.Restarts++ })
+}
+
+// The metrics of a camera, created the first time they are asked for
+func (e *Engine) metricsFor(id string) *cameraMetrics {
+	e.metricsMu.Lock()
+	defer e.metricsMu.Unlock()
+
+	m, ok := e.metrics[id]
+	if !ok {
+		m = &cameraMetrics{}
+		e.metrics[id] = m
+	}
+	return m
+}
+
+// . Serve /metrics
+var metricDefs = []struct {
+	name, kind, help string
+	value            func(v metricValues) float64
+}{
+	{"framewave_camera_fps", "gauge", "Frame rate reported by ffmpeg.", func(v metricValues) float64 { return float64(v.FPS) }},
+	{"framewave_frames_total", "counter", "Frames read from ffmpeg.", func(v metricValues) float64 { return float64(v.Frames) }},
+	{"framewave_frame_bytes_total", "counter", "Bytes of frames read from ffmpeg.", func(v metricValues) float64 { return float64(v.FrameBytes) }},
+	{"framewave_frame_size_bytes", "gauge", "Average size of recent frames.", func(v metricValues) float64 { return v.AvgFrameSize }},
+	{"framewave_frames_dropped_total", "counter", "Frames skipped for viewers that fell behind.", func(v metricValues) float64 { return float64(v.Dropped) }},
+	{"framewave_sent_bytes_total", "counter", "Bytes sent to viewers.", func(v metricValues) float64 { return float64(v.SentBytes) }},
+	{"framewave_clients", "gauge", "Viewers connected to the stream.", func(v metricValues) float64 { return float64(v.Clients) }},
+	{"framewave_ffmpeg_restarts_total", "counter", "Times ffmpeg was restarted after exiting or stalling.", func(v metricValues) float64 { return float64(v.Restarts) }},
+}
+
+func (e *Engine) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	cameras := slices.DeleteFunc(e.Cameras(), func(camera CameraSettings) bool {
+		return !e.canAccess(r, camera.ID)
+	})
+	values := make([]metricValues, len(cameras))
+	for i, camera := range cameras {
+		values[i] = e.metricsFor(camera.ID).values()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	streaming := 0
+	if e.Streaming() {
+		streaming = 1
+	}
+	fmt.Fprintln(w, "# HELP framewave_streaming Whether streaming is started.")
+	fmt.Fprintln(w, "# TYPE framewave_streaming gauge")
+	fmt.Fprintln(w, "framewave_streaming", streaming)
+
+	for _, def := range metricDefs {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", def.name, def.help, def.name, def.kind)
+		for i, camera := range cameras {
+			writeMetric(w, def.name, camera, def.value(values[i]))
+		}
+	}
+}
+
+func writeMetric(w io.Writer, name string, camera CameraSettings, value float64) {
+	fmt.Fprintf(w, "%s{camera=\"%s\",id=\"%s\"} %g\n", name, labelValue(camera.Name), labelValue(camera.ID), value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// . Motion detection
+// A detector taps the camera's frameHub and decodes a few frames a second,
+// comparing each one, downscaled to grayscale, with the one before. The share
+// of watched pixels that changed is the score. Motion starts when the score
+// reaches the camera's minimum area and ends once it has stayed below it for
+// motionCooldown.
+
+const (
+	motionWidth    = 64
+	motionHeight   = 48
+	motionInterval = 200 * time.Millisecond
+	motionCooldown = 2 * time.Second
+	motionHistory  = 100 // events kept per camera
+)
+
+// MotionEvent is a period of motion on a camera, End is nil while it lasts
+type MotionEvent struct {
+	Camera string     `json:"camera"`
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end"`
+	Score  float64    `json:"score"` // the highest percentage of watched pixels that changed
+}
+
+// MotionZone is a rectangle in percent of the frame
+type MotionZone struct {
+	X, Y, W, H int
+	Exclude    bool
+}
+
+// ParseMotionZones reads zones written as "x,y,w,h" in percent and separated
+// by ";". A zone starting with "-" is ignored rather than watched. Without any
+// watched zone the whole frame is.
+func ParseMotionZones(spec string) ([]MotionZone, error) {
+	var zones []MotionZone
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		zone := MotionZone{}
+		if strings.HasPrefix(part, "-") {
+			zone.Exclude = true
+			part = part[1:]
+		}
+		fields := strings.Split(part, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("zone %q isn't x,y,w,h", part)
+		}
+		var values [4]int
+		for i, field := range fields {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("zone %q must be in percent from 0 to 100", part)
+			}
+			values[i] = n
+		}
+		zone.X, zone.Y, zone.W, zone.H = values[0], values[1], values[2], values[3]
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+func (z MotionZone) contains(x, y float64) bool {
+	return x >= float64(z.X) && x < float64(z.X+z.W) && y >= float64(z.Y) && y < float64(z.Y+z.H)
+}
+
+// Which of the downscaled pixels are watched
+func motionMask(zones []MotionZone) []bool {
+	included := false
+	for _, zone := range zones {
+		included = included || !zone.Exclude
+	}
+
+	mask := make([]bool, motionWidth*motionHeight)
+	for y := 0; y < motionHeight; y++ {
+		for x := 0; x < motionWidth; x++ {
+			// Centre of the pixel in percent
+			px := (float64(x) + 0.5) * 100 / motionWidth
+			py := (float64(y) + 0.5) * 100 / motionHeight
+
+			watched := !included
+			for _, zone := range zones {
+				if zone.contains(px, py) {
+					if zone.Exclude {
+						watched = false
+						break
+					}
+					watched = true
+				}
+			}
+			mask[y*motionWidth+x] = watched
+		}
+	}
+	return mask
+}
+
+// . Validate motion settings
+func validateMotion(camera CameraSettings) error {
+	if camera.MotionSensitivity < 1 || camera.MotionSensitivity > 100 {
+		return fmt.Errorf("motion sensitivity must be 1-100, not %d", camera.MotionSensitivity)
+	}
+	if camera.MotionMinArea < 1 || camera.MotionMinArea > 100 {
+		return fmt.Errorf("the minimum motion area must be 1-100%%, not %d", camera.MotionMinArea)
+	}
+	_, err := ParseMotionZones(camera.MotionZones)
+	return err
+}
+
+// . Detector
+type motionDetector struct {
+	engine    *Engine
+	camera    CameraSettings
+	mask      []bool
+	threshold int // how much a pixel has to change to count
+	hub       *frameHub
+	client    *hubClient
+}
+
+func newMotionDetector(e *Engine, camera CameraSettings, hub *frameHub) *motionDetector {
+	zones, _ := ParseMotionZones(camera.MotionZones)
+	return &motionDetector{
+		engine:    e,
+		camera:    camera,
+		mask:      motionMask(zones),
+		threshold: 10 + (100-camera.MotionSensitivity)*60/100,
+		hub:       hub,
+	}
+}
+
+func (d *motionDetector) Start() {
+	d.client = d.hub.Tap(1)
+	go d.run()
+}
+
+func (d *motionDetector) Stop() {
+	d.hub.Unsubscribe(d.client)
+}
+
+func (d *motionDetector) run() {
+	var previous []uint8
+	var event *MotionEvent
+	var lastSample, lastMotion time.Time
+
+	for frame := range d.client.frames {
+		if time.Since(lastSample) < motionInterval {
+			continue
+		}
+		lastSample = time.Now()
+
+		gray, err := downscaleGray(frame)
+		if err != nil {
+			continue
+		}
+		if previous == nil {
+			previous = gray
+			continue
+		}
+		score := d.score(previous, gray)
+		previous = gray
+
+		//* Start, extend or end the current event
+		now := time.Now()
+		switch {
+		case score >= float64(d.camera.MotionMinArea):
+			lastMotion = now
+			if event == nil {
+				event = &MotionEvent{Camera: d.camera.ID, Start: now, Score: score}
+				d.engine.motionStarted(*event)
+			}
+			event.Score = max(event.Score, score)
+
+			// Keep the clip going for as long as there is motion, cameras
+			// without a clip buffer have nothing to save
+			d.engine.TriggerClip(d.camera.ID)
+		case event != nil && now.Sub(lastMotion) > motionCooldown:
+			end := lastMotion
+			event.End = &end
+			d.engine.motionEnded(*event)
+			event = nil
+		}
+	}
+
+	//* The stream stopped in the middle of an event
+	if event != nil {
+		end := time.Now()
+		event.End = &end
+		d.engine.motionEnded(*event)
+	}
+}
+
+// Percentage of watched pixels that changed by more than the threshold
+func (d *motionDetector) score(previous, current []uint8) float64 {
+	watched, changed := 0, 0
+	for i := range current {
+		if !d.mask[i] {
+			continue
+		}
+		watched++
+		diff := int(current[i]) - int(previous[i])
+		if diff > d.threshold || -diff > d.threshold {
+			changed++
+		}
+	}
+	if watched == 0 {
+		return 0
+	}
+	return float64(changed) * 100 / float64(watched)
+}
+
+// Decode a JPEG and average it down to motionWidth x motionHeight luma values
+func downscaleGray(frame []byte) ([]uint8, error) {
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+
+	//* JPEGs decode to YCbCr or Gray, whose Y plane is the luma
+	bounds := img.Bounds()
+	luma := func(x, y int) int {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return int((299*r + 587*g + 114*b) / 1000 >> 8)
+	}
+	switch img := img.(type) {
+	case *image.YCbCr:
+		luma = func(x, y int) int { return int(img.Y[img.YOffset(x, y)]) }
+	case *image.Gray:
+		luma = func(x, y int) int { return int(img.Pix[img.PixOffset(x, y)]) }
+	}
+
+	gray := make([]uint8, motionWidth*motionHeight)
+	for y := 0; y < motionHeight; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/motionHeight
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/motionHeight, y0+1)
+		for x := 0; x < motionWidth; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/motionWidth
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/motionWidth, x0+1)
+
+			sum, count := 0, 0
+			for sy := y0; sy < y1 && sy < bounds.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < bounds.Max.X; sx++ {
+					sum += luma(sx, sy)
+					count++
+				}
+			}
+			if count > 0 {
+				gray[y*motionWidth+x] = uint8(sum / count)
+			}
+		}
+	}
+	return gray, nil
+}
+
+// . Motion history
+func (e *Engine) motionStarted(event MotionEvent) {
+	e.motionMu.Lock()
+	events := append(e.motionEvents[event.Camera], event)
+	if len(events) > motionHistory {
+		events = events[len(events)-motionHistory:]
+	}
+	e.motionEvents[event.Camera] = events
+	e.motionMu.Unlock()
+
+	e.publish(Event{Type: MotionStarted, Camera: event.Camera, Motion: event})
+}
+
+func (e *Engine) motionEnded(event MotionEvent) {
+	e.motionMu.Lock()
+	events := e.motionEvents[event.Camera]
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Start.Equal(event.Start) {
+			events[i] = event
+			break
+		}
+	}
+	e.motionMu.Unlock()
+
+	e.publish(Event{Type: MotionEnded, Camera: event.Camera, Motion: event})
+}
+
+// MotionEvents lists a camera's recent motion, oldest first
+func (e *Engine) MotionEvents(id string) []MotionEvent {
+	e.motionMu.Lock()
+	defer e.motionMu.Unlock()
+	return append([]MotionEvent(nil), e.motionEvents[id]...)
+}
+
+// . Serve a camera's motion events as JSON
+func (e *Engine) serveMotion(cameraID string, w http.ResponseWriter, r *http.Request) {
+	events := e.MotionEvents(cameraID)
+	if events == nil {
+		events = []MotionEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
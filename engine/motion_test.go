@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMotionZones(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []MotionZone
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "0,0,50,100", want: []MotionZone{{X: 0, Y: 0, W: 50, H: 100}}},
+		{spec: " 10, 20, 30, 40 ; -0,0,100,10 ;", want: []MotionZone{
+			{X: 10, Y: 20, W: 30, H: 40},
+			{X: 0, Y: 0, W: 100, H: 10, Exclude: true},
+		}},
+		{spec: "0,0,50", wantErr: true},
+		{spec: "0,0,50,101", wantErr: true},
+		{spec: "0,-1,50,50", wantErr: true},
+		{spec: "a,0,50,50", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseMotionZones(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseMotionZones(%q) error = %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseMotionZones(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestMotionMask(t *testing.T) {
+	watched := func(mask []bool, x, y int) bool {
+		return mask[y*motionWidth+x]
+	}
+
+	//* No zones watch everything
+	for i, on := range motionMask(nil) {
+		if !on {
+			t.Fatalf("pixel %d isn't watched without zones", i)
+		}
+	}
+
+	//* Only the left half
+	mask := motionMask([]MotionZone{{X: 0, Y: 0, W: 50, H: 100}})
+	if !watched(mask, 0, 0) || !watched(mask, motionWidth/2-1, motionHeight-1) {
+		t.Error("left half isn't watched")
+	}
+	if watched(mask, motionWidth/2, 0) || watched(mask, motionWidth-1, motionHeight-1) {
+		t.Error("right half is watched")
+	}
+
+	//* Everything but the top rows, exclusions win over watched zones
+	mask = motionMask([]MotionZone{
+		{X: 0, Y: 0, W: 100, H: 100},
+		{X: 0, Y: 0, W: 100, H: 25, Exclude: true},
+	})
+	if watched(mask, 0, 0) || watched(mask, motionWidth-1, motionHeight/4-1) {
+		t.Error("excluded top is watched")
+	}
+	if !watched(mask, 0, motionHeight/4) || !watched(mask, motionWidth-1, motionHeight-1) {
+		t.Error("bottom isn't watched")
+	}
+
+	//* Only exclusions watch the rest of the frame
+	mask = motionMask([]MotionZone{{X: 50, Y: 0, W: 50, H: 100, Exclude: true}})
+	if !watched(mask, 0, 0) || watched(mask, motionWidth-1, 0) {
+		t.Error("exclusion alone doesn't watch the rest of the frame")
+	}
+}
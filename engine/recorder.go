@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"framewave/general"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// . Recording
+// A recorder taps the camera's frameHub and pipes its JPEGs into a second
+// ffmpeg that writes time-based segments, so recording runs whether or not
+// anyone is watching the stream. Old segments are deleted by age and by the
+// total size of the recordings directory.
+
+const (
+	RecordMKV = "mkv" // the camera's MJPEG in Matroska, nothing is re-encoded
+	RecordMP4 = "mp4" // H.264, much smaller but costs CPU
+)
+
+const (
+	recorderQueueSize  = 30
+	recorderRetryDelay = 10 * time.Second
+	retentionInterval  = time.Minute
+)
+
+type recorder struct {
+	camera     CameraSettings
+	config     Config
+	ffmpegPath string
+	hub        *frameHub
+	client     *hubClient
+	done       chan struct{}
+}
+
+func newRecorder(e *Engine, camera CameraSettings, hub *frameHub) *recorder {
+	return &recorder{
+		camera:     camera,
+		config:     e.config,
+		ffmpegPath: e.ffmpegPath,
+		hub:        hub,
+		done:       make(chan struct{}),
+	}
+}
+
+func (r *recorder) Start() {
+	r.client = r.hub.Tap(recorderQueueSize)
+	go r.run()
+}
+
+// Stop ends the recording, the returned channel is closed once ffmpeg has
+// finished writing the last segment
+func (r *recorder) Stop() <-chan struct{} {
+	r.hub.Unsubscribe(r.client)
+	return r.done
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	for {
+		err := r.record()
+		if err == nil {
+			return
+		}
+		log.Println("Recording", r.camera.Name, "failed:", err)
+
+		//* Drop frames until it's time to try again
+		retry := time.After(recorderRetryDelay)
+	wait:
+		for {
+			select {
+			case _, ok := <-r.client.frames:
+				if !ok {
+					return
+				}
+			case <-retry:
+				break wait
+			}
+		}
+	}
+}
+
+// Where the camera's segments go, a renamed camera gets a new recorder
+func (r *recorder) dir() string {
+	return filepath.Join(r.config.RecordDir, recordingDirName(r.camera.Name))
+}
+
+// Record until the tap is closed, which returns nil, or ffmpeg fails
+func (r *recorder) record() error {
+	dir := r.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	//* Start FFMPEG reading JPEGs from stdin
+	cmd := general.Command(r.ffmpegPath, recordArgs(r.config, dir)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	//* Feed frames until stopped
+	for frame := range r.client.frames {
+		if _, err := stdin.Write(frame); err != nil {
+			stdin.Close()
+			cmd.Wait()
+			return fmt.Errorf("ffmpeg exited: %s", strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	//* Closing stdin lets ffmpeg finish the segment
+	stdin.Close()
+	return cmd.Wait()
+}
+
+// . FFMPEG arguments for recording
+// Frames are timestamped as they arrive, since the camera's rate is never exact
+func recordArgs(config Config, dir string) []string {
+	args := []string{
+		"-loglevel", "error",
+		"-f", "mjpeg",
+		"-use_wallclock_as_timestamps", "1",
+		"-i", "-",
+	}
+
+	codec, ext := recordCodec(config)
+	args = append(args, codec...)
+	return append(args,
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(config.SegmentMinutes*60),
+		"-reset_timestamps", "1",
+		"-strftime", "1",
+		filepath.Join(dir, "%Y-%m-%d_%H-%M-%S."+ext),
+	)
+}
+
+// Output codec and file extension for the configured format
+func recordCodec(config Config) ([]string, string) {
+	if config.RecordFormat == RecordMP4 {
+		return []string{"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-vsync", "vfr"}, RecordMP4
+	}
+	return []string{"-c:v", "copy"}, RecordMKV
+}
+
+var (
+	unsafePathChars = regexp.MustCompile(`[^\w .-]+`)
+	segmentName     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}\.(` + RecordMKV + `|` + RecordMP4 + `)$`)
+)
+
+// Camera names can contain anything, keep them usable as a directory name
+func recordingDirName(name string) string {
+	return unsafePathChars.ReplaceAllString(name, "_")
+}
+
+// . Retention
+func (e *Engine) watchRecordings() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			e.enforceRetention()
+		}
+	}
+}
+
+// Retention never touches the segments being recorded
+func (e *Engine) enforceRetention() {
+	e.mu.Lock()
+	config := e.config
+	var dirs []string
+	for _, rec := range e.recorders {
+		dirs = append(dirs, rec.dir())
+	}
+	e.mu.Unlock()
+
+	active := make(map[string]bool)
+	for _, dir := range dirs {
+		if path := activeSegment(dir); path != "" {
+			active[path] = true
+		}
+	}
+	enforceRetention(config, active)
+}
+
+// The segment a recorder is writing to is the latest one by the time in its
+// name. Clips and timelapse exports share the directory but are named otherwise.
+func activeSegment(dir string) string {
+	entries, _ := os.ReadDir(dir)
+	latest := ""
+	for _, entry := range entries {
+		if segmentName.MatchString(entry.Name()) && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+	if latest == "" {
+		return ""
+	}
+	return filepath.Join(dir, latest)
+}
+
+// Delete segments older than RetentionDays, then the oldest ones until the
+// directory is under RetentionGB. Paths in active are kept.
+func enforceRetention(config Config, active map[string]bool) {
+	type segment struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var segments []segment
+	var total int64
+	for _, ext := range []string{RecordMKV, RecordMP4} {
+		paths, _ := filepath.Glob(filepath.Join(config.RecordDir, "*", "*."+ext))
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				segments = append(segments, segment{path, info.Size(), info.ModTime()})
+				total += info.Size()
+			}
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].modTime.Before(segments[j].modTime)
+	})
+
+	cutoff := time.Now().AddDate(0, 0, -config.RetentionDays)
+	limit := int64(config.RetentionGB) << 30
+	for _, seg := range segments {
+		tooOld := config.RetentionDays > 0 && seg.modTime.Before(cutoff)
+		tooBig := config.RetentionGB > 0 && total > limit
+		if !tooOld && !tooBig {
+			break
+		}
+		if active[seg.path] {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil {
+			continue
+		}
+		total -= seg.size
+	}
+}
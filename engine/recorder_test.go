@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSegment(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(-age)
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActiveSegment(t *testing.T) {
+	dir := t.TempDir()
+	day := 24 * time.Hour
+	writeSegment(t, filepath.Join(dir, "2026-01-01_00-00-00.mkv"), 0)
+	writeSegment(t, filepath.Join(dir, "2026-01-02_00-00-00.mp4"), 2*day)
+	writeSegment(t, filepath.Join(dir, "clip_2026-01-03_00-00-00.mkv"), 0)
+	writeSegment(t, filepath.Join(dir, "timelapse_2026-01-01_00-00_2026-01-04_00-00.mp4"), 0)
+
+	want := filepath.Join(dir, "2026-01-02_00-00-00.mp4")
+	if got := activeSegment(dir); got != want {
+		t.Errorf("activeSegment() = %q, want %q", got, want)
+	}
+	if got := activeSegment(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("activeSegment() of a missing directory = %q, want none", got)
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	config := Config{RecordDir: t.TempDir(), RetentionDays: 7}
+	day := 24 * time.Hour
+	old := filepath.Join(config.RecordDir, "Webcam", "2026-01-01_00-00-00.mkv")
+	oldClip := filepath.Join(config.RecordDir, "Webcam", "clip_2026-01-01_00-00-00.mkv")
+	recent := filepath.Join(config.RecordDir, "Webcam", "2026-01-09_00-00-00.mkv")
+	writing := filepath.Join(config.RecordDir, "Garden", "2026-01-01_00-00-00.mkv")
+	writeSegment(t, old, 10*day)
+	writeSegment(t, oldClip, 9*day)
+	writeSegment(t, recent, day)
+	writeSegment(t, writing, 10*day)
+
+	enforceRetention(config, map[string]bool{writing: true})
+
+	for path, kept := range map[string]bool{old: false, oldClip: false, recent: true, writing: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s kept = %v, want %v", filepath.Base(filepath.Dir(path))+"/"+filepath.Base(path), err == nil, kept)
+		}
+	}
+}
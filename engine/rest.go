@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// . Configuration API
+// GET  /api/cameras               every camera's settings
+// GET  /api/cameras/{name-or-id}  one camera's settings
+// PUT  /api/cameras/{name-or-id}  change the fields in the body, the rest are kept
+// GET  /api/cameras/{name-or-id}/options?resolution=  what the settings can be set to
+// GET  /api/cameras/{name-or-id}/stream.mjpg and snapshot.jpg
+// POST /api/start and /api/stop   start or stop streaming
+// Nothing can be changed until a user exists.
+// Changes go through UpdateCamera, so they are validated as a whole and saved
+// the same way as changes made in the window.
+
+// apiCamera is CameraSettings in the API's snake_case, settings.json keeps the
+// field names it was saved with. The fields must stay in the same order.
+type apiCamera struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	URL        string `json:"url"`
+	Resolution string `json:"resolution"`
+	Format     string `json:"format"`
+	FPS        int    `json:"fps"`
+	Quality    int    `json:"quality"`
+	Port       string `json:"port"`
+	Enabled    bool   `json:"enabled"`
+	MaxFPS     int    `json:"max_fps"`
+	Brightness int    `json:"brightness"`
+	Contrast   int    `json:"contrast"`
+	Saturation int    `json:"saturation"`
+	Sharpness  int    `json:"sharpness"`
+	Timestamp  bool   `json:"timestamp"`
+	Record     bool   `json:"record"`
+	Clips      bool   `json:"clips"`
+
+	Timelapse        bool `json:"timelapse"`
+	TimelapseSeconds int  `json:"timelapse_seconds"`
+
+	AllowedUsers string `json:"allowed_users"`
+
+	Motion            bool   `json:"motion"`
+	MotionSensitivity int    `json:"motion_sensitivity"`
+	MotionMinArea     int    `json:"motion_min_area"`
+	MotionZones       string `json:"motion_zones"`
+}
+
+// toAPICamera converts a camera for a response, without the credentials in
+// its URL
+func toAPICamera(camera CameraSettings) apiCamera {
+	api := apiCamera(camera)
+	api.URL = redactURL(camera.URL)
+	return api
+}
+
+// redactURL drops the user and password from a URL
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// What a camera's settings can be changed to
+type apiOptions struct {
+	Resolutions []string `json:"resolutions"`
+	Formats     []string `json:"formats"`
+	MinFPS      int      `json:"min_fps"`
+	MaxFPS      int      `json:"max_fps"`
+}
+
+func (e *Engine) serveCameras(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/api/cameras"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		cameras := []apiCamera{}
+		for _, camera := range e.Cameras() {
+			if e.canAccess(r, camera.ID) {
+				cameras = append(cameras, toAPICamera(camera))
+			}
+		}
+		writeJSON(w, http.StatusOK, cameras)
+		return
+	}
+
+	id, resource, _ := strings.Cut(path, "/")
+	id, err := url.PathUnescape(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	cameraID, ok := e.cameraByID(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !e.allowCamera(w, r, cameraID) {
+		return
+	}
+
+	switch resource {
+	case "":
+	case "options":
+		e.serveOptions(cameraID, w, r)
+		return
+	case "stream.mjpg":
+		e.serveMjpeg(cameraID, w, r)
+		return
+	case "snapshot.jpg":
+		e.serveSnapshot(cameraID, w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		camera, _ := e.Camera(cameraID)
+		writeJSON(w, http.StatusOK, toAPICamera(camera))
+	case http.MethodPut, http.MethodPatch:
+		if e.refuseAnonymous(w) {
+			return
+		}
+		e.updateCameraFromRequest(cameraID, w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch)
+	}
+}
+
+func (e *Engine) updateCameraFromRequest(cameraID string, w http.ResponseWriter, r *http.Request) {
+	camera, _ := e.Camera(cameraID)
+
+	//* Fields missing from the body keep their current value
+	body := apiCamera(camera)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated := CameraSettings(body)
+	updated.ID = cameraID
+	if updated.AllowedUsers != camera.AllowedUsers {
+		// Otherwise any user could lock the others out
+		http.Error(w, "Allowed users can only be changed in FrameWave", http.StatusForbidden)
+		return
+	}
+
+	if err := e.UpdateCamera(updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.publish(Event{Type: SettingsChanged, Camera: cameraID})
+
+	camera, _ = e.Camera(cameraID)
+	writeJSON(w, http.StatusOK, toAPICamera(camera))
+}
+
+// Options for the resolution in the query, or the camera's current one
+func (e *Engine) serveOptions(cameraID string, w http.ResponseWriter, r *http.Request) {
+	camera, _ := e.Camera(cameraID)
+	resolution := r.URL.Query().Get("resolution")
+	if resolution == "" {
+		resolution = camera.Resolution
+	}
+	format := camera.Format
+	formats := e.Formats(cameraID, resolution)
+	if !slices.Contains(formats, format) {
+		format = ""
+	}
+	minFps, maxFps := e.FPSRange(cameraID, resolution, format)
+
+	writeJSON(w, http.StatusOK, apiOptions{
+		Resolutions: e.Resolutions(cameraID, camera.Format),
+		Formats:     formats,
+		MinFPS:      minFps,
+		MaxFPS:      maxFps,
+	})
+}
+
+func (e *Engine) serveStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !e.allowEveryCamera(w, r) {
+		return
+	}
+	e.Start()
+	writeJSON(w, http.StatusOK, e.reportFor(r))
+}
+
+func (e *Engine) serveStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !e.allowEveryCamera(w, r) {
+		return
+	}
+	<-e.Stop()
+	writeJSON(w, http.StatusOK, e.reportFor(r))
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// . Ports
+// ValidatePort checks that a port is a number a server can listen on
+func ValidatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q is not a valid port", port)
+	}
+	return nil
+}
+
+// Check that no other program is listening on a port
+func portFree(port string) error {
+	ln, err := net.Listen("tcp", listenAddr(port))
+	if err != nil {
+		return fmt.Errorf("port %s is already in use", port)
+	}
+	return ln.Close()
+}
+
+func listenAddr(port string) string {
+	return "0.0.0.0:" + port
+}
+
+// Bind the server's port before serving, so a port that is in use is reported
+// to the caller instead of being lost in a goroutine. With TLS on it answers
+// HTTPS as well. Called with e.mu held.
+func (e *Engine) serve(server *http.Server) error {
+	var config *tls.Config
+	if e.config.TLS {
+		var err error
+		if config, err = e.serverTLS(); err != nil {
+			return err
+		}
+		server.Handler = plainHTTPPolicy(e.config.PlainHTTP, server.Handler)
+	}
+
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		ln = newSniffListener(ln, config)
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("Server on", server.Addr, "stopped:", err)
+		}
+	}()
+	return nil
+}
+
+// . Per-camera server
+// Serves the stream on /, the latest frame on /snapshot.jpg, its motion events
+// on /motion and saves a clip on a POST to /clip. Called with e.mu held.
+func (e *Engine) startCameraServer(camera CameraSettings) error {
+	// Shut down the old server if it exists.
+	if server, ok := e.servers[camera.ID]; ok {
+		server.Close()
+		delete(e.servers, camera.ID)
+	}
+
+	mux := http.NewServeMux()
+	cameraID := camera.ID
+	mux.HandleFunc("/", e.requireCamera(cameraID, func(w http.ResponseWriter, r *http.Request) {
+		e.serveMjpeg(cameraID, w, r)
+	}))
+	mux.HandleFunc("/snapshot.jpg", e.requireCamera(cameraID, func(w http.ResponseWriter, r *http.Request) {
+		e.serveSnapshot(cameraID, w, r)
+	}))
+	mux.HandleFunc("/motion", e.requireCamera(cameraID, func(w http.ResponseWriter, r *http.Request) {
+		e.serveMotion(cameraID, w, r)
+	}))
+	mux.HandleFunc("/clip", e.requireCamera(cameraID, func(w http.ResponseWriter, r *http.Request) {
+		e.serveClip(cameraID, w, r)
+	}))
+	server := &http.Server{
+		Addr:    listenAddr(camera.Port),
+		Handler: mux,
+	}
+	if err := e.serve(server); err != nil {
+		return err
+	}
+	e.servers[camera.ID] = server
+	return nil
+}
+
+// . Serve MJPEG stream
+func (e *Engine) serveMjpeg(cameraID string, w http.ResponseWriter, r *http.Request) {
+	const boundary = "frame"
+
+	hub := e.stream(cameraID)
+	if hub == nil {
+		http.Error(w, "Stream not running", http.StatusServiceUnavailable)
+		return
+	}
+	client := hub.Subscribe()
+	defer hub.Unsubscribe(client)
+	metrics := e.metricsFor(cameraID)
+	metrics.clientConnected(1)
+	defer metrics.clientConnected(-1)
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary="+boundary)
+	w.WriteHeader(http.StatusOK)
+
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "image/jpeg")
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case jpeg, ok := <-client.frames:
+			if !ok || jpeg == nil {
+				return
+			}
+			partWriter, err := mw.CreatePart(header)
+			if err != nil {
+				return
+			}
+			n, err := io.Copy(partWriter, bytes.NewReader(jpeg))
+			metrics.sent(n)
+			if err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// . Serve the latest frame as a single JPEG
+func (e *Engine) serveSnapshot(cameraID string, w http.ResponseWriter, r *http.Request) {
+	hub := e.stream(cameraID)
+	if hub == nil {
+		http.Error(w, "Stream not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	frame := hub.Latest()
+	if frame == nil {
+		http.Error(w, "No frame available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(frame)))
+	w.Header().Set("Cache-Control", "no-store")
+	n, _ := w.Write(frame)
+	e.metricsFor(cameraID).sent(int64(n))
+}
+
+// . Single-port server
+// Serves every running camera from one port under /cam/{name-or-id}/, with an
+// index page linking to their streams and snapshots. Per-port servers are still used when disabled.
+
+const sharedServerKey = "*"
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>FrameWave</title></head>
+<body style="font-family: sans-serif; background: #202530; color: #ededed">
+<h2>FrameWave</h2>
+{{range .}}<p><a style="color: #3f7ac3" href="{{.Path}}/stream.mjpg">{{.Name}}</a> {{.Resolution}} @ {{.FPS}} FPS (<a style="color: #3f7ac3" href="{{.Path}}/snapshot.jpg">snapshot</a>, <a style="color: #3f7ac3" href="{{.Path}}/motion">motion</a>)</p>
+{{else}}<p>No cameras are running.</p>
+{{end}}</body>
+</html>
+`))
+
+// Called with e.mu held
+func (e *Engine) startSharedServer() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cam/", e.serveCameraPath)
+	mux.HandleFunc("/", e.serveIndex)
+
+	server := &http.Server{
+		Addr:    listenAddr(e.config.ServerPort),
+		Handler: e.requireUser(mux.ServeHTTP),
+	}
+	if err := e.serve(server); err != nil {
+		return err
+	}
+	e.servers[sharedServerKey] = server
+	return nil
+}
+
+func (e *Engine) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type indexEntry struct {
+		Name       string
+		Path       string
+		Resolution string
+		FPS        int
+	}
+
+	var entries []indexEntry
+	for _, camera := range e.Cameras() {
+		if e.Running(camera.ID) && e.canAccess(r, camera.ID) {
+			entries = append(entries, indexEntry{camera.Name, cameraPath(camera.Name), camera.Resolution, camera.FPS})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, entries)
+}
+
+// . Route /cam/{name-or-id}/ to stream.mjpg, snapshot.jpg, motion and clip
+func (e *Engine) serveCameraPath(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/cam/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	cameraID, ok := e.cameraByID(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !e.allowCamera(w, r, cameraID) {
+		return
+	}
+
+	switch parts[1] {
+	case "stream.mjpg":
+		e.serveMjpeg(cameraID, w, r)
+	case "snapshot.jpg":
+		e.serveSnapshot(cameraID, w, r)
+	case "motion":
+		e.serveMotion(cameraID, w, r)
+	case "clip":
+		e.serveClip(cameraID, w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Cameras can be addressed by name, device ID or their position in the tab list
+func (e *Engine) cameraByID(id string) (string, bool) {
+	cameras := e.Cameras()
+	for _, camera := range cameras {
+		if camera.Name == id || camera.ID == id {
+			return camera.ID, true
+		}
+	}
+	if index, err := strconv.Atoi(id); err == nil && index >= 0 && index < len(cameras) {
+		return cameras[index].ID, true
+	}
+	return "", false
+}
+
+func cameraPath(cameraName string) string {
+	return "/cam/" + url.PathEscape(cameraName)
+}
+
+// . URL of a camera's stream on this machine
+func (e *Engine) StreamURL(cameraID string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	scheme := e.scheme()
+	camera := e.findCamera(cameraID)
+	switch {
+	case camera == nil:
+		return ""
+	case e.config.SinglePort:
+		return scheme + "127.0.0.1:" + e.config.ServerPort + cameraPath(camera.Name) + "/stream.mjpg"
+	default:
+		return scheme + "127.0.0.1:" + camera.Port
+	}
+}
+
+// Called with e.mu held
+func (e *Engine) scheme() string {
+	if e.config.TLS {
+		return "https://"
+	}
+	return "http://"
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// * Settings that apply to the whole app rather than a single camera
+type Config struct {
+	SinglePort bool
+	ServerPort string
+	APIPort    string // metrics and the other APIs, always served
+
+	// /healthz fails once an enabled camera has sent no frame for this long
+	HealthSeconds int
+
+	TLS       bool
+	CertFile  string // a self-signed certificate is used when empty
+	KeyFile   string
+	PlainHTTP string // PlainHTTPAllow, PlainHTTPRedirect or PlainHTTPRefuse on a TLS port
+
+	RecordDir      string
+	RecordFormat   string // RecordMKV or RecordMP4
+	SegmentMinutes int
+	RetentionDays  int // 0 keeps recordings forever
+	RetentionGB    int // 0 doesn't limit their size
+
+	PreRollSeconds  int // kept in memory for event clips
+	PostRollSeconds int // recorded after the last trigger
+}
+
+// SegmentLengths are the lengths recordings can be split at, in minutes
+var SegmentLengths = []int{5, 15, 60}
+
+// config.json is kept next to the per-camera settings.json
+func (e *Engine) configPath() string {
+	return filepath.Join(filepath.Dir(e.settingsPath), "config.json")
+}
+
+func (e *Engine) loadConfig() Config {
+	config := Config{
+		ServerPort:     "8080",
+		APIPort:        "8079",
+		HealthSeconds:  30,
+		PlainHTTP:      PlainHTTPRedirect,
+		RecordDir:      filepath.Join(filepath.Dir(e.settingsPath), "recordings"),
+		RecordFormat:   RecordMKV,
+		SegmentMinutes: 15,
+		RetentionDays:  7,
+
+		PreRollSeconds:  5,
+		PostRollSeconds: 10,
+	}
+
+	data, err := os.ReadFile(e.configPath())
+	if err != nil {
+		return config
+	}
+	_ = json.Unmarshal(data, &config)
+	return config
+}
+
+// Settings the servers are started with
+func serversChanged(old, updated Config) bool {
+	return old.SinglePort != updated.SinglePort || old.ServerPort != updated.ServerPort || tlsChanged(old, updated)
+}
+
+func tlsChanged(old, updated Config) bool {
+	return old.TLS != updated.TLS ||
+		old.CertFile != updated.CertFile ||
+		old.KeyFile != updated.KeyFile ||
+		old.PlainHTTP != updated.PlainHTTP
+}
+
+// Settings that change how cameras are recorded or clipped
+func recordingChanged(old, updated Config) bool {
+	return old.RecordDir != updated.RecordDir ||
+		old.RecordFormat != updated.RecordFormat ||
+		old.SegmentMinutes != updated.SegmentMinutes ||
+		old.PreRollSeconds != updated.PreRollSeconds ||
+		old.PostRollSeconds != updated.PostRollSeconds
+}
+
+// Called with e.mu held
+func (e *Engine) saveConfig() {
+	data, err := json.MarshalIndent(e.config, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(e.configPath(), data, 0644)
+}
+
+// . Camera settings
+// Keyed by camera ID, or by name for settings saved before IDs were used
+func (e *Engine) loadSettings() map[string]CameraSettings {
+	var loadedCameras []CameraSettings
+	data, err := os.ReadFile(e.settingsPath)
+	if err != nil {
+		return make(map[string]CameraSettings)
+	}
+	err = json.Unmarshal(data, &loadedCameras)
+	if err != nil {
+		return make(map[string]CameraSettings)
+	}
+
+	settingsMap := make(map[string]CameraSettings)
+	for _, cam := range loadedCameras {
+		if cam.ID != "" {
+			settingsMap[cam.ID] = cam
+		} else {
+			settingsMap[cam.Name] = cam
+		}
+	}
+	return settingsMap
+}
+
+// Called with e.mu held
+func (e *Engine) saveSettings(updatedCameraID string) {
+	settingsMap := e.loadSettings()
+
+	if camera := e.findCamera(updatedCameraID); camera != nil {
+		settingsMap[updatedCameraID] = *camera
+	}
+
+	e.writeSettings(settingsMap)
+}
+
+func (e *Engine) deleteSettings(cameraID string) {
+	settingsMap := e.loadSettings()
+	delete(settingsMap, cameraID)
+	e.writeSettings(settingsMap)
+}
+
+func (e *Engine) writeSettings(settingsMap map[string]CameraSettings) {
+	var updatedCameras []CameraSettings
+	for _, cam := range settingsMap {
+		updatedCameras = append(updatedCameras, cam)
+	}
+
+	data, err := json.MarshalIndent(updatedCameras, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(e.settingsPath, data, 0644)
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// . Status API
+// /api/status is everything the window shows about each camera as JSON, and
+// /healthz answers 503 while any enabled camera isn't delivering frames.
+
+type CameraReport struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Enabled     bool       `json:"enabled"`
+	Running     bool       `json:"running"`
+	State       State      `json:"state"`
+	Resolution  string     `json:"resolution"`
+	Quality     int        `json:"quality"`
+	Port        string     `json:"port"`
+	URL         string     `json:"url"`
+	FPS         int        `json:"fps"`          // configured
+	MeasuredFPS int        `json:"measured_fps"` // reported by ffmpeg
+	Uptime      float64    `json:"uptime"`       // seconds frames have been coming in
+	Clients     int        `json:"clients"`
+	LastFrame   *time.Time `json:"last_frame"`
+	LastError   string     `json:"last_error"`
+	Restarts    int        `json:"restarts"`
+	Recording   bool       `json:"recording"`
+	Motion      bool       `json:"motion"`
+}
+
+type StatusReport struct {
+	Streaming bool           `json:"streaming"`
+	Cameras   []CameraReport `json:"cameras"`
+}
+
+// Report collects the state of every camera
+func (e *Engine) Report() StatusReport {
+	report := StatusReport{Streaming: e.Streaming(), Cameras: []CameraReport{}}
+
+	for _, camera := range e.Cameras() {
+		metrics := e.metricsFor(camera.ID).values()
+		status, _ := e.Status(camera.ID)
+
+		entry := CameraReport{
+			ID:          camera.ID,
+			Name:        camera.Name,
+			Enabled:     camera.Enabled,
+			Running:     e.Running(camera.ID),
+			State:       status.State,
+			Resolution:  camera.Resolution,
+			Quality:     camera.Quality,
+			Port:        camera.Port,
+			URL:         e.StreamURL(camera.ID),
+			FPS:         camera.FPS,
+			MeasuredFPS: metrics.FPS,
+			Clients:     metrics.Clients,
+			LastError:   status.LastError,
+			Restarts:    status.Restarts,
+			Recording:   status.Recording,
+			Motion:      status.Motion,
+		}
+		if !status.RunningSince.IsZero() {
+			entry.Uptime = time.Since(status.RunningSince).Seconds()
+		}
+		if !metrics.LastFrame.IsZero() {
+			entry.LastFrame = &metrics.LastFrame
+		}
+		report.Cameras = append(report.Cameras, entry)
+	}
+	return report
+}
+
+func (e *Engine) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, e.reportFor(r))
+}
+
+// The report with only the cameras the request's user may see
+func (e *Engine) reportFor(r *http.Request) StatusReport {
+	report := e.Report()
+	report.Cameras = slices.DeleteFunc(report.Cameras, func(camera CameraReport) bool {
+		return !e.canAccess(r, camera.ID)
+	})
+	return report
+}
+
+// . Health
+// Unhealthy reports every enabled camera that has sent no frame for
+// Config.HealthSeconds. A camera that was just started gets that long to send
+// its first one.
+func (e *Engine) Unhealthy() []string {
+	timeout := time.Duration(e.Config().HealthSeconds) * time.Second
+	streaming := e.Streaming()
+
+	var problems []string
+	for _, camera := range e.Cameras() {
+		if !camera.Enabled {
+			continue
+		}
+		if !streaming {
+			problems = append(problems, camera.Name+": not streaming")
+			continue
+		}
+
+		status, _ := e.Status(camera.ID)
+		lastFrame := e.metricsFor(camera.ID).values().LastFrame
+		if status.Started.After(lastFrame) {
+			lastFrame = status.Started
+		}
+		if lastFrame.IsZero() {
+			problems = append(problems, camera.Name+": not running")
+		} else if time.Since(lastFrame) > timeout {
+			problems = append(problems, fmt.Sprintf("%s: no frames for %s", camera.Name, time.Since(lastFrame).Round(time.Second)))
+		}
+	}
+	return problems
+}
+
+func (e *Engine) serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if problems := e.Unhealthy(); len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"framewave/capture"
+	"framewave/general"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// . Capture supervisor
+// Runs ffmpeg for one camera and restarts it with exponential backoff when it
+// exits or stops producing frames. The camera's frameHub outlives the restarts,
+// so HTTP clients stay connected while ffmpeg comes back.
+
+type State string
+
+const (
+	StateStarting   State = "Starting"
+	StateRunning    State = "Running"
+	StateRestarting State = "Restarting"
+	StateFailed     State = "Failed"
+	StateOffline    State = "Offline" // the device is unplugged
+)
+
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 30 * time.Second
+	maxRestarts     = 10               // consecutive failures before giving up
+	stableRunTime   = 1 * time.Minute  // a run this long resets the backoff
+	startupTimeout  = 30 * time.Second // time allowed for the first frame
+	stallTimeout    = 10 * time.Second // time allowed between frames
+)
+
+var errStopped = errors.New("stopped")
+
+type supervisor struct {
+	engine  *Engine
+	id      string
+	name    string
+	modes   []capture.Mode
+	stream  *frameHub
+	metrics *cameraMetrics
+	stop    chan struct{}
+
+	mu        sync.Mutex
+	camera    CameraSettings
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stopped   bool
+	state     State
+	lastError string
+	restarts  int
+	lastFrame time.Time
+	started   time.Time // when the camera was started
+	running   time.Time // since when frames have been coming in, zero if they aren't
+}
+
+func newSupervisor(engine *Engine, camera CameraSettings, modes []capture.Mode, stream *frameHub) *supervisor {
+	return &supervisor{
+		engine:  engine,
+		id:      camera.ID,
+		name:    camera.Name,
+		modes:   modes,
+		camera:  camera,
+		stream:  stream,
+		metrics: engine.metricsFor(camera.ID),
+		stop:    make(chan struct{}),
+		state:   StateStarting,
+		started: time.Now(),
+	}
+}
+
+func (s *supervisor) Start() {
+	go s.run()
+}
+
+// Stop kills ffmpeg and prevents any further restarts
+func (s *supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+}
+
+// Status returns the current state, the last error and how often ffmpeg was restarted
+func (s *supervisor) Status() CameraStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CameraStatus{State: s.state, LastError: s.lastError, Restarts: s.restarts, Started: s.started, RunningSince: s.running}
+}
+
+// Adjust applies new image adjustments to the running ffmpeg through its
+// command prompt on stdin, so viewers see them without reconnecting. Later
+// restarts of ffmpeg use the new settings as well. It reports whether they
+// reached a running ffmpeg, a failed camera or one between runs needs a restart.
+func (s *supervisor) Adjust(camera CameraSettings) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.camera = camera
+	if s.stdin == nil {
+		return false, nil
+	}
+	if _, err := io.WriteString(s.stdin, adjustCommands(camera)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fail marks a camera that couldn't be started at all. It doesn't notify,
+// because it is called with the engine's lock held.
+func (s *supervisor) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.state = StateFailed
+	s.lastError = err.Error()
+}
+
+func (s *supervisor) setState(state State, err error) {
+	s.mu.Lock()
+	s.state = state
+	s.running = time.Time{}
+	if err != nil {
+		s.lastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+func (s *supervisor) notify() {
+	s.engine.publish(Event{Type: StateChanged, Camera: s.id})
+}
+
+// Called by processFrames for every frame
+func (s *supervisor) frameReceived() {
+	s.mu.Lock()
+	s.lastFrame = time.Now()
+	changed := s.state != StateRunning
+	s.state = StateRunning
+	if changed {
+		s.running = s.lastFrame
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.notify()
+	}
+}
+
+func (s *supervisor) run() {
+	delay := minRestartDelay
+	failures := 0
+
+	for {
+		started := time.Now()
+		err := s.capture()
+		s.metrics.setFPS(0)
+		if errors.Is(err, errStopped) {
+			return
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		//* A long healthy run starts the backoff over
+		if time.Since(started) >= stableRunTime {
+			delay = minRestartDelay
+			failures = 0
+		}
+		failures++
+		log.Println("FFMPEG for", s.name, "stopped:", err)
+
+		if failures > maxRestarts {
+			s.setState(StateFailed, err)
+			return
+		}
+		s.setState(StateRestarting, err)
+
+		//* Wait before restarting
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+		s.metrics.restarted()
+	}
+}
+
+// . Run ffmpeg once, until it exits or stalls
+func (s *supervisor) capture() error {
+	//* Build command
+	s.mu.Lock()
+	camera := s.camera
+	s.mu.Unlock()
+
+	cmd := general.Command(s.engine.ffmpegPath, ffmpegArgs(camera, s.modes)...)
+	ffmpegOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrReader, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	//* Start FFMPEG for the specific camera
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return errStopped
+	}
+	if err := cmd.Start(); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	s.cmd = cmd
+	s.stdin = stdin
+	s.lastFrame = time.Time{}
+	s.mu.Unlock()
+
+	//* Read frames and stderr until ffmpeg exits
+	var wg sync.WaitGroup
+	var lastLine string
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		lastLine = monitorFPS(stderrReader, s)
+	}()
+	go func() {
+		defer wg.Done()
+		processFrames(ffmpegOut, s, camera)
+	}()
+
+	//* Kill ffmpeg if it stops producing frames
+	done := make(chan struct{})
+	stalled := make(chan bool, 1)
+	go s.watchdog(cmd, time.Now(), done, stalled)
+
+	wg.Wait()
+	waitErr := cmd.Wait()
+	close(done)
+
+	s.mu.Lock()
+	s.cmd = nil
+	s.stdin = nil
+	s.mu.Unlock()
+
+	if <-stalled {
+		return fmt.Errorf("no frames received for %v", stallTimeout)
+	}
+	switch {
+	case lastLine != "":
+		return fmt.Errorf("ffmpeg exited: %s", lastLine)
+	case waitErr != nil:
+		return fmt.Errorf("ffmpeg exited: %w", waitErr)
+	default:
+		return errors.New("ffmpeg exited")
+	}
+}
+
+func (s *supervisor) watchdog(cmd *exec.Cmd, started time.Time, done chan struct{}, stalled chan bool) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			stalled <- false
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		lastFrame := s.lastFrame
+		s.mu.Unlock()
+
+		if (lastFrame.IsZero() && time.Since(started) > startupTimeout) ||
+			(!lastFrame.IsZero() && time.Since(lastFrame) > stallTimeout) {
+			stalled <- true
+			cmd.Process.Kill()
+			return
+		}
+	}
+}
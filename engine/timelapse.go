@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"framewave/general"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// . Timelapse
+// A timelapser saves the camera's latest frame every TimelapseSeconds into a
+// directory per day under the camera's recordings. ExportTimelapse assembles
+// the saved frames of any range into an MP4. The frames aren't subject to the
+// retention policy, they are small and only deleted by hand.
+
+const (
+	timelapseDir        = "timelapse"
+	timelapseDayFormat  = "2006-01-02"
+	timelapseTimeFormat = "15-04-05"
+)
+
+type timelapser struct {
+	camera CameraSettings
+	dir    string
+	hub    *frameHub
+	stop   chan struct{}
+}
+
+func newTimelapser(e *Engine, camera CameraSettings, hub *frameHub) *timelapser {
+	return &timelapser{
+		camera: camera,
+		dir:    timelapsePath(e.config, camera.Name),
+		hub:    hub,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (t *timelapser) Start() {
+	go t.run()
+}
+
+func (t *timelapser) Stop() {
+	close(t.stop)
+}
+
+func (t *timelapser) run() {
+	ticker := time.NewTicker(time.Duration(t.camera.TimelapseSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			frame := t.hub.Latest()
+			if frame == nil {
+				continue
+			}
+			dir := filepath.Join(t.dir, now.Format(timelapseDayFormat))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Println("Can't save timelapse frame of", t.camera.Name+":", err)
+				continue
+			}
+			path := filepath.Join(dir, now.Format(timelapseTimeFormat)+".jpg")
+			if err := os.WriteFile(path, frame, 0644); err != nil {
+				log.Println("Can't save timelapse frame of", t.camera.Name+":", err)
+			}
+		}
+	}
+}
+
+func timelapsePath(config Config, cameraName string) string {
+	return filepath.Join(config.RecordDir, recordingDirName(cameraName), timelapseDir)
+}
+
+func validateTimelapse(camera CameraSettings) error {
+	if camera.TimelapseSeconds < 1 {
+		return fmt.Errorf("timelapse frames must be at least a second apart, not %d", camera.TimelapseSeconds)
+	}
+	return nil
+}
+
+// Start or stop saving timelapse frames of a camera to match its settings.
+// Called with e.mu held.
+func (e *Engine) applyTimelapse(id string) {
+	if timelapser, ok := e.timelapsers[id]; ok {
+		timelapser.Stop()
+		delete(e.timelapsers, id)
+	}
+
+	camera := e.findCamera(id)
+	stream := e.streams[id]
+	if !e.streaming || camera == nil || !camera.Timelapse || stream == nil || e.offline[id] {
+		return
+	}
+	timelapser := newTimelapser(e, *camera, stream)
+	e.timelapsers[id] = timelapser
+	timelapser.Start()
+}
+
+// . Export
+// TimelapseDays lists the days a camera has timelapse frames for, oldest first
+func (e *Engine) TimelapseDays(id string) []string {
+	camera, ok := e.Camera(id)
+	if !ok {
+		return nil
+	}
+
+	entries, _ := os.ReadDir(timelapsePath(e.Config(), camera.Name))
+	var days []string
+	for _, entry := range entries {
+		if _, err := time.Parse(timelapseDayFormat, entry.Name()); err == nil && entry.IsDir() {
+			days = append(days, entry.Name())
+		}
+	}
+	sort.Strings(days)
+	return days
+}
+
+// ExportTimelapse encodes the frames saved between from and to into an MP4
+// played at fps, and returns its path. It takes a while, call it off the UI.
+func (e *Engine) ExportTimelapse(id string, from, to time.Time, fps int) (string, error) {
+	camera, ok := e.Camera(id)
+	if !ok {
+		return "", fmt.Errorf("unknown camera %q", id)
+	}
+	if fps < 1 {
+		return "", fmt.Errorf("%d FPS is too slow", fps)
+	}
+	dir := timelapsePath(e.Config(), camera.Name)
+
+	//* Collect the frames in the range, the paths sort by time
+	var frames []string
+	for _, day := range e.TimelapseDays(id) {
+		paths, _ := filepath.Glob(filepath.Join(dir, day, "*.jpg"))
+		for _, path := range paths {
+			at, err := time.ParseInLocation(timelapseDayFormat+" "+timelapseTimeFormat,
+				day+" "+strings.TrimSuffix(filepath.Base(path), ".jpg"), time.Local)
+			if err == nil && !at.Before(from) && at.Before(to) {
+				frames = append(frames, path)
+			}
+		}
+	}
+	sort.Strings(frames)
+	if len(frames) == 0 {
+		return "", errors.New("no timelapse frames were saved in that range")
+	}
+
+	//* Feed them to ffmpeg one at a time as an MJPEG stream, x264 needs even dimensions
+	output := filepath.Join(filepath.Dir(dir), fmt.Sprintf("timelapse_%s_%s.mp4",
+		from.Format(timelapseDayFormat+"_"+timelapseTimeFormat), to.Format(timelapseDayFormat+"_"+timelapseTimeFormat)))
+	cmd := general.Command(e.ffmpegPath,
+		"-loglevel", "error",
+		"-y",
+		"-framerate", strconv.Itoa(fps),
+		"-f", "mjpeg",
+		"-i", "-",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		output,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var readErr error
+	for _, path := range frames {
+		frame, err := os.ReadFile(path)
+		if err != nil {
+			readErr = err
+			break
+		}
+		if _, err := stdin.Write(frame); err != nil {
+			// ffmpeg exited, Wait says why
+			break
+		}
+	}
+	stdin.Close()
+
+	if readErr != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.Remove(output)
+		return "", readErr
+	}
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
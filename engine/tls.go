@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// . HTTPS
+// With TLS on, every server answers HTTPS and plain HTTP on the same port by
+// looking at the first byte a client sends, a TLS handshake starts with 0x16.
+// Plain HTTP is then allowed, redirected to HTTPS or refused. The certificate
+// is the user's own, or a self-signed one generated once and kept next to the
+// settings.
+
+const (
+	PlainHTTPAllow    = "allow"
+	PlainHTTPRedirect = "redirect"
+	PlainHTTPRefuse   = "refuse"
+)
+
+const (
+	tlsHandshake     = 0x16
+	sniffTimeout     = 10 * time.Second
+	certificateYears = 10
+)
+
+// The certificate is loaded once, changing the TLS settings clears it.
+// Called with e.mu held.
+func (e *Engine) serverTLS() (*tls.Config, error) {
+	if e.tlsConfig != nil {
+		return e.tlsConfig, nil
+	}
+
+	certFile, keyFile := e.config.CertFile, e.config.KeyFile
+	if certFile == "" {
+		certFile, keyFile = e.selfSignedPaths()
+		if _, err := os.Stat(certFile); errors.Is(err, fs.ErrNotExist) {
+			if err := generateCertificate(certFile, keyFile); err != nil {
+				return nil, fmt.Errorf("can't create a certificate: %w", err)
+			}
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load the certificate: %w", err)
+	}
+
+	e.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	return e.tlsConfig, nil
+}
+
+func (e *Engine) selfSignedPaths() (string, string) {
+	dir := filepath.Dir(e.settingsPath)
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// A certificate for this machine's name and addresses
+func generateCertificate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname, Organization: []string{"FrameWave"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(certificateYears, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// . Plain HTTP on a TLS port
+func plainHTTPPolicy(mode string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch mode {
+		case PlainHTTPRedirect:
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		case PlainHTTPRefuse:
+			http.Error(w, "Use HTTPS", http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// . Sniffing listener
+// Accepted connections are sorted into TLS and plain ones in their own
+// goroutine, so a client that sends nothing doesn't hold up the others.
+type sniffListener struct {
+	net.Listener
+	config *tls.Config
+
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSniffListener(ln net.Listener, config *tls.Config) *sniffListener {
+	l := &sniffListener{
+		Listener: ln,
+		config:   config,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *sniffListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.errs <- err
+			return
+		}
+		go l.sniff(conn)
+	}
+}
+
+func (l *sniffListener) sniff(conn net.Conn) {
+	var first [1]byte
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	_, err := conn.Read(first[:])
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	var sorted net.Conn = &peekedConn{Conn: conn, peeked: first[:]}
+	if first[0] == tlsHandshake {
+		sorted = tls.Server(sorted, l.config)
+	}
+	select {
+	case l.conns <- sorted:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *sniffListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// A connection whose first bytes were already read
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
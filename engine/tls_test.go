@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlainHTTPPolicy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		mode     string
+		secure   bool
+		status   int
+		location string
+	}{
+		{PlainHTTPAllow, false, http.StatusOK, ""},
+		{PlainHTTPRedirect, false, http.StatusPermanentRedirect, "https://cam.local:8080/api/status?x=1"},
+		{PlainHTTPRefuse, false, http.StatusForbidden, ""},
+		{PlainHTTPRedirect, true, http.StatusOK, ""},
+		{PlainHTTPRefuse, true, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://cam.local:8080/api/status?x=1", nil)
+		if test.secure {
+			r.TLS = &tls.ConnectionState{}
+		}
+		recorder := httptest.NewRecorder()
+		plainHTTPPolicy(test.mode, ok).ServeHTTP(recorder, r)
+		if recorder.Code != test.status {
+			t.Errorf("%s, TLS %v: status = %d, want %d", test.mode, test.secure, recorder.Code, test.status)
+		}
+		if location := recorder.Header().Get("Location"); location != test.location {
+			t.Errorf("%s, TLS %v: Location = %q, want %q", test.mode, test.secure, location, test.location)
+		}
+	}
+}
+
+func TestSniffListener(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := generateCertificate(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := newSniffListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			io.WriteString(w, "tls")
+		} else {
+			io.WriteString(w, "plain")
+		}
+	})}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	//* A client that sends nothing doesn't hold up the others
+	silent, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	for scheme, want := range map[string]string{"http": "plain", "https": "tls"} {
+		resp, err := client.Get(scheme + "://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("GET over %s: %v", scheme, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("GET over %s = %q, want %q", scheme, body, want)
+		}
+	}
+
+	server.Close()
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Serve() = %v, want %v", err, http.ErrServerClosed)
+	}
+}
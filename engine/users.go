@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// . Users
+// Logins are kept in users.json next to the settings, with a salted
+// PBKDF2-SHA256 hash instead of the password. Every request is checked against
+// the current users, so changes apply to running servers at once. While there
+// are no users the servers are open to everyone.
+// Only a few logins are hashed at a time, the rest wait their turn, so a flood
+// of wrong passwords can't take every core away from the cameras.
+
+const (
+	hashIterations = 100000
+	saltSize       = 16
+	maxHashChecks  = 2
+)
+
+type User struct {
+	Username   string
+	Salt       string // base64
+	Hash       string // base64
+	Iterations int
+}
+
+type userStore struct {
+	path string
+
+	mu    sync.Mutex
+	users []User
+	// Logins that already passed the slow hash, cleared whenever users change
+	verified map[[sha256.Size]byte]string
+	hashing  chan struct{} // a slot for each login being hashed
+}
+
+func newUserStore(path string) *userStore {
+	store := &userStore{
+		path:     path,
+		verified: make(map[[sha256.Size]byte]string),
+		hashing:  make(chan struct{}, maxHashChecks),
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		_ = json.Unmarshal(data, &store.users)
+	}
+	return store
+}
+
+// Called with s.mu held
+func (s *userStore) save() error {
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *userStore) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for _, user := range s.users {
+		names = append(names, user.Username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *userStore) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users) == 0
+}
+
+func (s *userStore) set(username, password string) error {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	user := User{
+		Username:   username,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Hash:       base64.StdEncoding.EncodeToString(pbkdf2SHA256([]byte(password), salt, hashIterations, sha256.Size)),
+		Iterations: hashIterations,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = slices.DeleteFunc(s.users, func(u User) bool { return u.Username == username })
+	s.users = append(s.users, user)
+	clear(s.verified)
+	return s.save()
+}
+
+func (s *userStore) remove(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := len(s.users)
+	s.users = slices.DeleteFunc(s.users, func(u User) bool { return u.Username == username })
+	if len(s.users) == count {
+		return fmt.Errorf("there is no user %q", username)
+	}
+	clear(s.verified)
+	return s.save()
+}
+
+// Check a login, returning the username it belongs to
+func (s *userStore) check(username, password string) (string, bool) {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+
+	s.mu.Lock()
+	if name, ok := s.verified[key]; ok {
+		s.mu.Unlock()
+		return name, true
+	}
+	var found *User
+	for i := range s.users {
+		if subtle.ConstantTimeCompare([]byte(s.users[i].Username), []byte(username)) == 1 {
+			user := s.users[i]
+			found = &user
+		}
+	}
+	s.mu.Unlock()
+
+	//* Unknown users are hashed as well, so they take as long to refuse
+	user := User{Iterations: hashIterations}
+	if found != nil {
+		user = *found
+	}
+	salt, _ := base64.StdEncoding.DecodeString(user.Salt)
+	want, _ := base64.StdEncoding.DecodeString(user.Hash)
+	s.hashing <- struct{}{}
+	got := pbkdf2SHA256([]byte(password), salt, user.Iterations, sha256.Size)
+	<-s.hashing
+	if found == nil || subtle.ConstantTimeCompare(got, want) != 1 {
+		return "", false
+	}
+
+	s.mu.Lock()
+	s.verified[key] = user.Username
+	s.mu.Unlock()
+	return user.Username, true
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// . Managing users
+// Users lists who can log in
+func (e *Engine) Users() []string {
+	return e.users.names()
+}
+
+// SetUser adds a user or changes their password
+func (e *Engine) SetUser(username, password string) error {
+	username = strings.TrimSpace(username)
+	switch {
+	case username == "":
+		return errors.New("the username can't be empty")
+	case strings.ContainsAny(username, ":,"):
+		return errors.New("the username can't contain : or ,")
+	case password == "":
+		return errors.New("the password can't be empty")
+	}
+	return e.users.set(username, password)
+}
+
+func (e *Engine) RemoveUser(username string) error {
+	return e.users.remove(username)
+}
+
+// . Access control
+type userContextKey struct{}
+
+// requireUser asks for a login unless there are no users, and passes the
+// username on in the request's context
+func (e *Engine) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if e.users.empty() {
+			next(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok {
+			username, ok = e.users.check(username, password)
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, username)))
+	}
+}
+
+// requireCamera is requireUser for a single camera's handlers
+func (e *Engine) requireCamera(cameraID string, next http.HandlerFunc) http.HandlerFunc {
+	return e.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if e.allowCamera(w, r, cameraID) {
+			next(w, r)
+		}
+	})
+}
+
+// Whether the request's user may see a camera, refusing the request if not.
+// Cameras without allowed users are open to every user.
+func (e *Engine) allowCamera(w http.ResponseWriter, r *http.Request, cameraID string) bool {
+	if e.canAccess(r, cameraID) {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// Whether the request's user may see every camera, which starting and stopping
+// them all needs, refusing the request if not
+func (e *Engine) allowEveryCamera(w http.ResponseWriter, r *http.Request) bool {
+	for _, camera := range e.Cameras() {
+		if !e.canAccess(r, camera.ID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) canAccess(r *http.Request, cameraID string) bool {
+	username, ok := r.Context().Value(userContextKey{}).(string)
+	if !ok {
+		// No users, no login
+		return true
+	}
+	camera, _ := e.Camera(cameraID)
+	allowed := AllowedUsers(camera)
+	return len(allowed) == 0 || slices.Contains(allowed, username)
+}
+
+// AllowedUsers splits a camera's comma separated list of users
+func AllowedUsers(camera CameraSettings) []string {
+	var users []string
+	for _, user := range strings.Split(camera.AllowedUsers, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
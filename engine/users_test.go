@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// PBKDF2-HMAC-SHA256 vectors from RFC 7914 section 11
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, 64))
+		if got != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
+
+func TestCheckWaitsForHashSlot(t *testing.T) {
+	store := newUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err := store.set("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	//* Every slot is taken, so the login waits
+	for i := 0; i < maxHashChecks; i++ {
+		store.hashing <- struct{}{}
+	}
+	done := make(chan bool)
+	go func() {
+		_, ok := store.check("alice", "secret")
+		done <- ok
+	}()
+	select {
+	case <-done:
+		t.Fatal("check() ran with every hash slot taken")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-store.hashing
+	if ok := <-done; !ok {
+		t.Error("check() after a slot freed = false, want true")
+	}
+}
+
+func TestAllowedUsers(t *testing.T) {
+	camera := testCamera(func(camera *CameraSettings) { camera.AllowedUsers = " alice, ,bob ," })
+	if got, want := AllowedUsers(camera), []string{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllowedUsers() = %q, want %q", got, want)
+	}
+}
+
+func TestSetUserValidation(t *testing.T) {
+	e := testEngine(t)
+	for _, login := range [][2]string{{" ", "secret"}, {"al:ice", "secret"}, {"al,ice", "secret"}, {"alice", ""}} {
+		if err := e.SetUser(login[0], login[1]); err == nil {
+			t.Errorf("SetUser(%q, %q) = nil, want an error", login[0], login[1])
+		}
+	}
+	if err := e.SetUser(" alice ", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Users(); !reflect.DeepEqual(got, []string{"alice"}) {
+		t.Errorf("Users() = %q, want [alice]", got)
+	}
+}
+
+// whoAmI answers with the logged in user, or "anonymous"
+func whoAmI(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(userContextKey{}).(string)
+	if !ok {
+		username = "anonymous"
+	}
+	io.WriteString(w, username)
+}
+
+// loginRequest is a GET of target as username, or without a login if it's empty
+func loginRequest(target, username, password string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if username != "" {
+		r.SetBasicAuth(username, password)
+	}
+	return r
+}
+
+func TestRequireUser(t *testing.T) {
+	e := testEngine(t)
+
+	//* Open to everyone without users, except what needs a login
+	if status, body := serveRequest(e.requireUser(whoAmI), loginRequest("/", "", "")); status != http.StatusOK || body != "anonymous" {
+		t.Errorf("requireUser() without users = %d %q, want %d anonymous", status, body, http.StatusOK)
+	}
+	if status, _ := serveRequest(e.requireLogin(whoAmI), loginRequest("/", "", "")); status != http.StatusForbidden {
+		t.Errorf("requireLogin() without users = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if err := e.SetUser("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, username, password string
+		status                   int
+		body                     string
+	}{
+		{"no login", "", "", http.StatusUnauthorized, ""},
+		{"wrong password", "alice", "wrong", http.StatusUnauthorized, ""},
+		{"unknown user", "bob", "secret", http.StatusUnauthorized, ""},
+		{"login", "alice", "secret", http.StatusOK, "alice"},
+		{"remembered login", "alice", "secret", http.StatusOK, "alice"},
+	}
+	for _, test := range tests {
+		for _, handler := range []http.HandlerFunc{e.requireUser(whoAmI), e.requireLogin(whoAmI)} {
+			recorder := httptest.NewRecorder()
+			handler(recorder, loginRequest("/", test.username, test.password))
+			if recorder.Code != test.status {
+				t.Errorf("%s: status = %d, want %d", test.name, recorder.Code, test.status)
+			}
+			if test.status == http.StatusOK && recorder.Body.String() != test.body {
+				t.Errorf("%s: user = %q, want %q", test.name, recorder.Body.String(), test.body)
+			}
+			if test.status == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: no WWW-Authenticate header", test.name)
+			}
+		}
+	}
+
+	//* A changed password is checked again
+	if err := e.SetUser("alice", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := serveRequest(e.requireUser(whoAmI), loginRequest("/", "alice", "secret")); status != http.StatusUnauthorized {
+		t.Errorf("old password after a change = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestCameraAccess(t *testing.T) {
+	open := testCamera(nil)
+	private := testCamera(func(camera *CameraSettings) {
+		camera.ID, camera.Name, camera.AllowedUsers = "private", "Private", "alice"
+	})
+	e := testEngine(t, open, private)
+	for _, username := range []string{"alice", "bob"} {
+		if err := e.SetUser(username, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		username, target string
+		status           int
+	}{
+		{"alice", "/api/cameras/Private", http.StatusOK},
+		{"bob", "/api/cameras/Private", http.StatusForbidden},
+		{"bob", "/api/cameras/Webcam", http.StatusOK},
+		{"bob", "/api/cameras/1/snapshot.jpg", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		status, _ := serveRequest(e.requireUser(e.serveCameras), loginRequest(test.target, test.username, "secret"))
+		if status != test.status {
+			t.Errorf("GET %s as %s = %d, want %d", test.target, test.username, status, test.status)
+		}
+	}
+
+	//* The list leaves out cameras the user can't see
+	for username, want := range map[string][]string{"alice": {"Webcam", "Private"}, "bob": {"Webcam"}} {
+		_, body := serveRequest(e.requireUser(e.serveCameras), loginRequest("/api/cameras", username, "secret"))
+		var cameras []apiCamera
+		if err := json.Unmarshal([]byte(body), &cameras); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, camera := range cameras {
+			names = append(names, camera.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("GET /api/cameras as %s = %q, want %q", username, names, want)
+		}
+	}
+
+	//* Only a user who sees every camera can start or stop them all
+	everyCamera := e.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if e.allowEveryCamera(w, r) {
+			whoAmI(w, r)
+		}
+	})
+	for username, want := range map[string]int{"alice": http.StatusOK, "bob": http.StatusForbidden} {
+		if status, _ := serveRequest(everyCamera, loginRequest("/", username, "secret")); status != want {
+			t.Errorf("allowEveryCamera() as %s = %d, want %d", username, status, want)
+		}
+	}
+
+	//* requireCamera guards a single camera's own server
+	if status, _ := serveRequest(e.requireCamera("private", whoAmI), loginRequest("/", "bob", "secret")); status != http.StatusForbidden {
+		t.Errorf("requireCamera() as bob = %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,177 @@
+// FrameWave web UI, everything goes through the REST API on this server
+
+const grid = document.getElementById("grid");
+const settings = document.getElementById("settings");
+const errorText = document.getElementById("error");
+const resolutionSelect = document.getElementById("resolution");
+
+let status = { streaming: false, cameras: [] };
+let selected = null; // name of the camera in the settings panel
+let camera = null; // its settings
+
+// Cameras are addressed by name, device IDs can be paths with slashes in them
+function cameraPath(name) {
+	return "/api/cameras/" + encodeURIComponent(name);
+}
+
+async function api(path, options) {
+	const response = await fetch(path, options);
+	if (!response.ok) {
+		throw new Error((await response.text()).trim() || response.statusText);
+	}
+	return response.json();
+}
+
+// Grid of cameras, their snapshots refresh while streaming
+async function refreshStatus() {
+	try {
+		status = await api("/api/status");
+	} catch (err) {
+		document.getElementById("streaming").textContent = err.message;
+		return;
+	}
+
+	document.getElementById("streaming").textContent = status.streaming ? "Streaming" : "Stopped";
+	document.getElementById("toggle").textContent = status.streaming ? "Stop" : "Start";
+
+	const names = new Set(status.cameras.map((cam) => cam.name));
+	for (const card of [...grid.children]) {
+		if (!names.has(card.dataset.name)) {
+			card.remove();
+		}
+	}
+
+	for (const cam of status.cameras) {
+		let card = [...grid.children].find((card) => card.dataset.name === cam.name);
+		if (!card) {
+			card = document.createElement("div");
+			card.className = "card";
+			card.dataset.name = cam.name;
+			card.innerHTML = "<img alt=''><div><span class='name'></span><span class='state'></span></div>";
+			card.onclick = () => select(cam.name);
+			grid.appendChild(card);
+		}
+		card.classList.toggle("selected", cam.name === selected);
+		card.querySelector(".name").textContent = cam.name;
+
+		const state = card.querySelector(".state");
+		state.className = "state " + cam.state;
+		state.textContent = cam.running ? `${cam.state || ""} ${cam.measured_fps} FPS` : cam.enabled ? "Stopped" : "Disabled";
+
+		const img = card.querySelector("img");
+		if (cam.running && cam.last_frame) {
+			img.src = cameraPath(cam.name) + "/snapshot.jpg?t=" + Date.now();
+		} else {
+			img.removeAttribute("src");
+		}
+	}
+}
+
+// Settings panel, like a tab in the window
+async function select(name) {
+	selected = name;
+	errorText.textContent = "";
+	try {
+		camera = await api(cameraPath(name));
+	} catch (err) {
+		errorText.textContent = err.message;
+		return;
+	}
+	settings.hidden = false;
+	document.getElementById("name").textContent = camera.name;
+	document.getElementById("live").src = cameraPath(name) + "/stream.mjpg";
+	await showOptions(camera.resolution);
+	showSettings();
+	refreshStatus();
+}
+
+async function showOptions(resolution) {
+	const options = await api(cameraPath(selected) + "/options?resolution=" + encodeURIComponent(resolution));
+	resolutionSelect.innerHTML = "";
+	for (const res of options.resolutions || []) {
+		resolutionSelect.add(new Option(res, res));
+	}
+	const fps = settings.querySelector("[data-field=fps]");
+	fps.min = options.min_fps;
+	fps.max = options.max_fps;
+	return options;
+}
+
+function showSettings() {
+	resolutionSelect.value = camera.resolution;
+	for (const input of settings.querySelectorAll("[data-field]")) {
+		const value = camera[input.dataset.field];
+		if (input.type === "checkbox") {
+			input.checked = value;
+		} else {
+			input.value = value;
+		}
+	}
+	for (const span of settings.querySelectorAll("[data-value]")) {
+		span.textContent = camera[span.dataset.value];
+	}
+}
+
+async function update(change) {
+	errorText.textContent = "";
+	try {
+		camera = await api(cameraPath(selected), {
+			method: "PUT",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify(change),
+		});
+	} catch (err) {
+		errorText.textContent = err.message;
+		camera = await api(cameraPath(selected));
+	}
+	showSettings();
+	refreshStatus();
+}
+
+for (const input of settings.querySelectorAll("[data-field]")) {
+	const field = input.dataset.field;
+	input.oninput = () => {
+		const span = settings.querySelector(`[data-value=${field}]`);
+		if (span) {
+			span.textContent = input.value;
+		}
+	};
+	input.onchange = () => {
+		if (input.type === "checkbox") {
+			update({ [field]: input.checked });
+		} else if (input.type === "range") {
+			update({ [field]: Number(input.value) });
+		} else {
+			update({ [field]: input.value });
+		}
+	};
+}
+
+// A new resolution keeps the frame rate within what it supports
+resolutionSelect.onchange = async () => {
+	const resolution = resolutionSelect.value;
+	const options = await showOptions(resolution);
+	const change = {
+		resolution: resolution,
+		fps: Math.min(Math.max(camera.fps, options.min_fps), options.max_fps),
+	};
+	if (!(options.formats || []).includes(camera.format)) {
+		change.format = "";
+	}
+	update(change);
+};
+
+document.getElementById("toggle").onclick = async () => {
+	try {
+		status = await api(status.streaming ? "/api/stop" : "/api/start", { method: "POST" });
+	} catch (err) {
+		errorText.textContent = err.message;
+	}
+	if (selected) {
+		document.getElementById("live").src = cameraPath(selected) + "/stream.mjpg?t=" + Date.now();
+	}
+	refreshStatus();
+};
+
+refreshStatus();
+setInterval(refreshStatus, 1000);
@@ -0,0 +1,19 @@
+package engine
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// . Web UI
+// A grid of every camera with the same settings as the window's tabs, served
+// from the API server's root. It only uses the REST API, so it shares its login.
+
+//go:embed web
+var webFiles embed.FS
+
+func webHandler() http.Handler {
+	files, _ := fs.Sub(webFiles, "web")
+	return http.FileServer(http.FS(files))
+}
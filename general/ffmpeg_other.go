@@ -0,0 +1,30 @@
+//go:build !windows
+
+package general
+
+import (
+	"os/exec"
+)
+
+// FfmpegPath returns the ffmpeg found on the PATH, ffmpeg is only bundled on Windows
+func FfmpegPath() string {
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		return path
+	}
+	return "ffmpeg"
+}
+
+func CreateFfmpeg() {
+	_, _ = createFramewaveDir()
+}
+
+// Command builds an exec.Cmd, kept for parity with the Windows build
+func Command(name string, args ...string) *exec.Cmd {
+	return exec.Command(name, args...)
+}
+
+// KillProcByName does nothing here, the ffmpeg on the PATH is shared with
+// every other program and each supervisor already stops its own process
+func KillProcByName(procname string) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package general
+
+import (
+	_ "embed"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+//go:embed ffmpeg.exe
+var ffmpegEXE []byte
+
+// FfmpegPath returns the location of the bundled ffmpeg executable
+func FfmpegPath() string {
+	return filepath.Join(RoamingDir(), "FrameWave", "ffmpeg.exe")
+}
+
+func CreateFfmpeg() {
+	if _, err := createFramewaveDir(); err != nil {
+		return
+	}
+
+	ffmpegPath := FfmpegPath()
+	if _, err := os.Stat(ffmpegPath); os.IsNotExist(err) {
+		// Only write the file if it doesn't exist already
+		_ = os.WriteFile(ffmpegPath, ffmpegEXE, 0755)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Command builds an exec.Cmd that doesn't pop up a console window
+func Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd
+}
+
+func KillProcByName(procname string) error {
+	kill := Command("taskkill", "/im", procname, "/T", "/F")
+	err := kill.Run()
+	if err != nil {
+		return err
+	}
+	return nil
+}
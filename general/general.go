@@ -1,19 +1,12 @@
 package general
 
 import (
-	_ "embed"
 	"fmt"
 	"image/color"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"syscall"
-	"time"
 )
 
-//go:embed ffmpeg.exe
-var ffmpegEXE []byte
-
 func HumanReadableSize(bytes int) string {
 	const (
 		_          = iota // ignore first value by assigning to blank identifier
@@ -62,30 +55,14 @@ func RoamingDir() string {
 	return roaming
 }
 
-func CreateFfmpeg() {
+// Create the FrameWave directory if it doesn't exist
+func createFramewaveDir() (string, error) {
 	framewavePath := filepath.Join(RoamingDir(), "FrameWave")
 
-	// Check if framewave directory exists, create if not
 	if _, err := os.Stat(framewavePath); os.IsNotExist(err) {
 		if err := os.Mkdir(framewavePath, 0755); err != nil {
-			return
+			return "", err
 		}
 	}
-
-	ffmpegPath := filepath.Join(framewavePath, "ffmpeg.exe")
-	if _, err := os.Stat(ffmpegPath); os.IsNotExist(err) {
-		// Only write the file if it doesn't exist already
-		_ = os.WriteFile(ffmpegPath, ffmpegEXE, 0755)
-		time.Sleep(100 * time.Millisecond)
-	}
-}
-
-func KillProcByName(procname string) error {
-	kill := exec.Command("taskkill", "/im", procname, "/T", "/F")
-	kill.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	err := kill.Run()
-	if err != nil {
-		return err
-	}
-	return nil
+	return framewavePath, nil
 }
@@ -6,5 +6,11 @@ import (
 )
 
 var Version string = "1.00"
-var App fyne.App = app.NewWithID("FrameWave")
-var Win fyne.Window = App.NewWindow("FrameWave " + Version)
+var App fyne.App
+var Win fyne.Window
+
+// Init creates the app and its window, headless mode never calls it
+func Init() {
+	App = app.NewWithID("FrameWave")
+	Win = App.NewWindow("FrameWave " + Version)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"framewave/engine"
+	"log"
+	"time"
+)
+
+// . Headless mode
+// Streams every enabled camera from the saved settings without building any
+// widgets, until ctx is cancelled. A username saves that user with the password
+// before starting. With no cameras enabled the API keeps running, so they can
+// be enabled from the web UI.
+func runHeadless(ctx context.Context, eng *engine.Engine, username, password string) error {
+	if username != "" {
+		if err := eng.SetUser(username, password); err != nil {
+			return err
+		}
+	}
+
+	var enabled []engine.CameraSettings
+	for _, camera := range eng.Cameras() {
+		if camera.Enabled {
+			enabled = append(enabled, camera)
+		}
+	}
+	if len(enabled) == 0 {
+		log.Println("No cameras are enabled in", eng.SettingsPath()+", enable them from the web UI")
+	}
+	if len(eng.Users()) == 0 {
+		log.Println("The web UI needs a user, add one with -username and -password")
+	}
+
+	eng.Subscribe(func(event engine.Event) {
+		camera, _ := eng.Camera(event.Camera)
+		switch event.Type {
+		case engine.MotionStarted:
+			log.Printf("%s: motion started", camera.Name)
+		case engine.MotionEnded:
+			log.Printf("%s: motion ended after %s, score %.1f%%", camera.Name, event.Motion.End.Sub(event.Motion.Start).Round(time.Second), event.Motion.Score)
+		case engine.ClipSaved:
+			log.Printf("%s: saved clip %s", camera.Name, event.Path)
+		}
+		if event.Type != engine.StateChanged {
+			return
+		}
+		if status, ok := eng.Status(event.Camera); ok {
+			if status.State == engine.StateRunning || status.LastError == "" {
+				log.Printf("%s: %s", camera.Name, status.State)
+			} else {
+				log.Printf("%s: %s: %s", camera.Name, status.State, status.LastError)
+			}
+		}
+	})
+
+	eng.Start()
+	if err := eng.APIError(); err != nil {
+		log.Println("API unavailable:", err)
+	} else {
+		log.Println("Serving the web UI and API at", eng.APIURL())
+	}
+	for _, camera := range enabled {
+		log.Printf("Streaming %s at %s", camera.Name, eng.StreamURL(camera.ID))
+	}
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	<-eng.Stop()
+	return nil
+}
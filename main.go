@@ -1,14 +1,45 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"framewave/engine"
 	"framewave/general"
 	"framewave/globals"
 	"framewave/ui"
+	"log"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
+	headless := flag.Bool("headless", false, "stream the enabled cameras without a window")
+	config := flag.String("config", "", "path to settings.json")
+	username := flag.String("username", "", "save a user who can log in to the streams, in headless mode")
+	password := flag.String("password", "", "password of the user saved with -username")
+	flag.Parse()
+
 	general.CreateFfmpeg()
-	ui.Init()
+	settingsPath := engine.DefaultSettingsPath()
+	if *config != "" {
+		settingsPath = *config
+	}
+	eng := engine.New(settingsPath)
+	defer eng.Close()
+
+	if *headless {
+		log.SetOutput(os.Stdout)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runHeadless(ctx, eng, *username, *password); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	globals.Init()
+	ui.Init(eng)
 	globals.Win.ShowAndRun()
 }
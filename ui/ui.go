@@ -1,32 +1,21 @@
 package ui
 
 import (
-	"bufio"
-	"bytes"
-	"context"
-	"encoding/json"
-	"os"
+	"errors"
 	"path/filepath"
-	"sync"
 
 	"fmt"
+	"framewave/capture"
 	"framewave/colormap"
+	"framewave/engine"
 	fynecustom "framewave/fyneCustom"
 	"framewave/fyneTheme"
 	"framewave/general"
 	"framewave/globals"
-	"io"
-	"log"
-	"mime/multipart"
-	"net/http"
-	"net/textproto"
 	"net/url"
-	"os/exec"
-	"regexp"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	_ "embed"
@@ -34,37 +23,13 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 )
 
 //go:embed nostream.png
 var noStreamImg []byte
 
-// * Backend
-type CameraSettings struct {
-	Name       string
-	Resolution string
-	FPS        int
-	Quality    int
-	Port       string
-	Enabled    bool
-	MaxFPS     int
-	Brightness int
-	Contrast   int
-	Saturation int
-	Sharpness  int
-}
-
-var streams map[string]chan []byte
-var servers map[string]*http.Server
-var stopChan chan bool
-var ffmpegCmds map[string]*exec.Cmd
-var ffmpegPath = filepath.Join(general.RoamingDir(), "FrameWave", "ffmpeg.exe")
-var cameras []CameraSettings
-var selectedCamera string
-var ffmpegCmdsMutex sync.Mutex
-var allowSaving = false
-
 // * Elements
 var streamImg = &fynecustom.CustomImage{
 	FixedWidth:  384,
@@ -76,6 +41,18 @@ var toggleButton = &widget.Button{
 	Text: "Start",
 }
 
+var addCameraButton = &widget.Button{
+	Text: "Add Network Camera",
+}
+
+var recordingButton = &widget.Button{
+	Text: "Recording Settings",
+}
+
+var httpsButton = &widget.Button{
+	Text: "HTTPS Settings",
+}
+
 var usernameEntry = &widget.Entry{
 	PlaceHolder: "Username",
 }
@@ -84,6 +61,16 @@ var passwordEntry = &widget.Entry{
 	PlaceHolder: "Password",
 }
 
+var usersLabel = &widget.Label{}
+
+var saveUserButton = &widget.Button{
+	Text: "Save User",
+}
+
+var removeUserButton = &widget.Button{
+	Text: "Remove User",
+}
+
 var previewCheckbox = &widget.Check{
 	Checked: true,
 	Text:    "Enable Preview",
@@ -95,31 +82,60 @@ var previewCheckbox = &widget.Check{
 	},
 }
 
+var singlePortCheck = &widget.Check{
+	Text: "Single Port",
+}
+
+var serverPortEntry = &widget.Entry{
+	PlaceHolder: "Port",
+}
+
+var apiPortEntry = &widget.Entry{
+	PlaceHolder: "Port",
+}
+
 var authForm = container.NewCenter(
 	container.New(&fynecustom.MinWidthFormLayout{MinColWidth: 200},
 		&widget.Label{Text: "Username"},
 		usernameEntry,
 		&widget.Label{Text: "Password"},
 		passwordEntry,
+		usersLabel,
+		container.NewGridWithColumns(2, saveUserButton, removeUserButton),
+		singlePortCheck,
+		serverPortEntry,
+		&widget.Label{Text: "API Port"},
+		apiPortEntry,
 	),
 )
 
-// * Main view
-var mainView = container.NewBorder(
-	container.NewVBox(
-		streamImg,
-		currentFpsLabel,
-		container.NewCenter(previewCheckbox),
-		&canvas.Line{StrokeColor: colormap.Gray, StrokeWidth: 1}),
-	container.NewVBox(
-		&canvas.Line{StrokeColor: colormap.Gray, StrokeWidth: 1},
-		authForm,
-		toggleButton,
-		openStreamButton),
-	nil,
-	nil,
-	genTabs(),
-)
+var eng *engine.Engine
+var selectedCamera string // ID of the camera whose tab is open
+var cameraTabs *container.AppTabs
+var tabCameras = make(map[*container.TabItem]string)
+
+// * Main view, built in Init once the cameras are loaded
+var mainView *fyne.Container
+
+func newMainView() *fyne.Container {
+	return container.NewBorder(
+		container.NewVBox(
+			streamImg,
+			currentFpsLabel,
+			captureStatusLabel,
+			container.NewCenter(previewCheckbox),
+			&canvas.Line{StrokeColor: colormap.Gray, StrokeWidth: 1}),
+		container.NewVBox(
+			&canvas.Line{StrokeColor: colormap.Gray, StrokeWidth: 1},
+			authForm,
+			container.NewGridWithColumns(3, addCameraButton, recordingButton, httpsButton),
+			toggleButton,
+			openStreamButton),
+		nil,
+		nil,
+		genTabs(),
+	)
+}
 
 var currentFpsLabel = &canvas.Text{
 	Text:      "FPS: N/A",
@@ -128,23 +144,20 @@ var currentFpsLabel = &canvas.Text{
 	Alignment: fyne.TextAlignCenter,
 }
 
+var captureStatusLabel = &canvas.Text{
+	Color:     colormap.OffWhite,
+	TextSize:  12,
+	Alignment: fyne.TextAlignCenter,
+}
+
 // . Add a new button for opening the stream URL
 var openStreamButton = &widget.Button{
 	Text: "Open Stream URL",
 	OnTapped: func() {
-		// Find the camera settings for the selected camera
-		var selectedCameraSettings CameraSettings
-		for _, camera := range cameras {
-			if camera.Name == selectedCamera {
-				selectedCameraSettings = camera
-				break
-			}
-		}
-
-		// Check if a stream channel exists for the selected camera
-		if _, streamRunning := streams[selectedCamera]; streamRunning {
-			// Construct the stream URL using the selected camera's port
-			url, _ := url.Parse("http://127.0.0.1:" + selectedCameraSettings.Port)
+		// Check if a stream exists for the selected camera
+		if eng.Running(selectedCamera) {
+			// Construct the stream URL for the selected camera
+			url, _ := url.Parse(eng.StreamURL(selectedCamera))
 			globals.App.OpenURL(url)
 		} else {
 			// Stream is not running for the selected camera, handle accordingly (e.g., show a message)
@@ -154,10 +167,9 @@ var openStreamButton = &widget.Button{
 }
 
 // . Initalization
-func Init() {
-	streams = make(map[string]chan []byte)
-	servers = make(map[string]*http.Server)
-	ffmpegCmds = make(map[string]*exec.Cmd)
+func Init(e *engine.Engine) {
+	eng = e
+	mainView = newMainView()
 
 	streamImg.SetResource(fyne.NewStaticResource("nostream.png", noStreamImg))
 	streamImg.Refresh()
@@ -175,374 +187,214 @@ func Init() {
 	globals.App.Settings().SetTheme(fyneTheme.CustomTheme{})
 
 	//. Disable toggle button if no cameras are enabled
-	anyCameraEnabled := false
-	for _, cam := range cameras {
-		if cam.Enabled {
-			anyCameraEnabled = true
-			break
+	refreshToggleButton()
+
+	//. Set add camera button action
+	addCameraButton.OnTapped = showAddCameraDialog
+	recordingButton.OnTapped = showRecordingDialog
+	httpsButton.OnTapped = showHTTPSDialog
+
+	//. Single-port server settings
+	config := eng.Config()
+	singlePortCheck.SetChecked(config.SinglePort)
+	serverPortEntry.SetText(config.ServerPort)
+	singlePortCheck.OnChanged = func(checked bool) {
+		config := eng.Config()
+		config.SinglePort = checked
+		if err := eng.UpdateConfig(config); err != nil {
+			dialog.ShowError(err, globals.Win)
+			singlePortCheck.SetChecked(eng.Config().SinglePort)
 		}
 	}
-	if !anyCameraEnabled {
-		toggleButton.Disable()
-	}
-
-	//. Set toggle button action
-	toggleButton.OnTapped = func() {
-		if toggleButton.Text == "Start" {
-			startStreaming()
-		} else {
-			stopStreaming()
+	serverPortEntry.Validator = engine.ValidatePort
+	serverPortEntry.OnSubmitted = func(text string) {
+		if serverPortEntry.Validator(text) == nil {
+			config := eng.Config()
+			config.ServerPort = text
+			if err := eng.UpdateConfig(config); err != nil {
+				dialog.ShowError(err, globals.Win)
+				serverPortEntry.SetText(eng.Config().ServerPort)
+			}
 		}
 	}
-}
-
-// . Server MJPEG stream
-func serveMjpeg(cameraName string, w http.ResponseWriter, r *http.Request) {
-	const boundary = "frame"
-
-	w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary="+boundary)
-	w.WriteHeader(http.StatusOK)
-
-	mw := multipart.NewWriter(w)
-	mw.SetBoundary(boundary)
-	header := textproto.MIMEHeader{}
-	header.Set("Content-Type", "image/jpeg")
 
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case jpeg, ok := <-streams[cameraName]:
-			if !ok || jpeg == nil {
-				return
+	//. The API server restarts on its own port, cameras keep streaming
+	apiPortEntry.SetText(config.APIPort)
+	apiPortEntry.Validator = engine.ValidatePort
+	apiPortEntry.OnSubmitted = func(text string) {
+		if apiPortEntry.Validator(text) == nil {
+			config := eng.Config()
+			config.APIPort = text
+			if err := eng.UpdateConfig(config); err != nil {
+				dialog.ShowError(err, globals.Win)
+				apiPortEntry.SetText(eng.Config().APIPort)
+			} else if err := eng.APIError(); err != nil {
+				dialog.ShowError(err, globals.Win)
 			}
-			partWriter, _ := mw.CreatePart(header)
-			io.Copy(partWriter, bytes.NewReader(jpeg))
 		}
 	}
-}
 
-func basicAuthMiddleware(username, password string, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if username == "" {
-			next(w, r)
+	//. Users are saved hashed and apply to running servers at once
+	showUsers()
+	saveUserButton.OnTapped = func() {
+		if err := eng.SetUser(usernameEntry.Text, passwordEntry.Text); err != nil {
+			dialog.ShowError(err, globals.Win)
 			return
 		}
-
-		user, pass, ok := r.BasicAuth()
-		if !ok || user != username || pass != password {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		passwordEntry.SetText("")
+		showUsers()
+	}
+	removeUserButton.OnTapped = func() {
+		if err := eng.RemoveUser(strings.TrimSpace(usernameEntry.Text)); err != nil {
+			dialog.ShowError(err, globals.Win)
 			return
 		}
-		next(w, r)
+		usernameEntry.SetText("")
+		passwordEntry.SetText("")
+		showUsers()
 	}
-}
-
-// . Start streaming
-func startStreaming() {
-	toggleButton.SetText("Stop")
-	stopChan = make(chan bool)
-	general.KillProcByName("ffmpeg.exe")
 
-	for _, camera := range cameras {
-		if camera.Enabled {
-			streams[camera.Name] = make(chan []byte, 30)
-
-			// Shut down the old server if it exists.
-			if server, ok := servers[camera.Name]; ok {
-				server.Close()
-				delete(servers, camera.Name)
-			}
-
-			mux := http.NewServeMux()
-			localCamera := camera
-			mux.HandleFunc("/", basicAuthMiddleware(usernameEntry.Text, passwordEntry.Text, func(w http.ResponseWriter, r *http.Request) {
-				serveMjpeg(localCamera.Name, w, r) // Use the local copy instead
-			}))
-			server := &http.Server{
-				Addr:    "0.0.0.0:" + camera.Port,
-				Handler: mux,
-			}
-			servers[camera.Name] = server
-			go server.ListenAndServe()
-
-			go mjpegCapture(camera)
+	//. Set toggle button action
+	toggleButton.OnTapped = func() {
+		if !eng.Streaming() {
+			eng.Start()
+		} else {
+			eng.Stop()
 		}
 	}
 
-	// Enable the "Open Stream URL" button for the selected camera
-	if _, streamRunning := streams[selectedCamera]; streamRunning {
-		openStreamButton.Enable()
-	}
+	//. Follow the engine
+	eng.Subscribe(handleEvent)
 }
 
-// . Stop streaming
-func stopStreaming() {
-	toggleButton.SetText("Start")
-	currentFpsLabel.Text = "FPS: N/A"
-	currentFpsLabel.Color = colormap.OffWhite
-	currentFpsLabel.Refresh()
-	streamImg.SetResource(fyne.NewStaticResource("nostream.png", noStreamImg))
-	streamImg.Refresh()
-	openStreamButton.Disable()
-
-	// Create a new stop channel and close the old one if it exists
-	newStopChan := make(chan bool)
-	oldStopChan := stopChan
-	stopChan = newStopChan
-
-	go func() {
-		// Close the old stop channel outside of this goroutine
-		if oldStopChan != nil {
-			close(oldStopChan)
+func handleEvent(event engine.Event) {
+	switch event.Type {
+	case engine.StreamingChanged:
+		showStreamingState()
+	case engine.FrameReceived:
+		if selectedCamera == event.Camera && previewCheckbox.Checked {
+			streamImg.SetResource(fyne.NewStaticResource("frame.jpeg", event.Frame))
+			streamImg.Refresh()
 		}
-
-		for _, cmd := range ffmpegCmds {
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
+	case engine.FPSChanged:
+		if selectedCamera == event.Camera {
+			currentFpsLabel.Text = "FPS: " + strconv.Itoa(event.FPS)
+			currentFpsLabel.Color = general.GetColorForFPS(event.FPS)
+			currentFpsLabel.Refresh()
 		}
-		ffmpegCmds = make(map[string]*exec.Cmd)
-
-		for key, serv := range servers {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			serv.Shutdown(ctx)
-			delete(servers, key)
-		}
-	}()
-}
-
-// . FFMPEG Capture
-func mjpegCapture(camera CameraSettings) {
-	//* Create stream channel
-	if _, exists := streams[camera.Name]; !exists {
-		streams[camera.Name] = make(chan []byte, 100)
-	}
-	stream := streams[camera.Name]
-
-	//* Configure FFMPEG
-	ffmpegArgs := []string{
-		"-f", "dshow",
-		"-rtbufsize", "100M",
-		"-probesize", "32",
-		"-i", "video=" + camera.Name,
-		"-pix_fmt", "yuv420p",
-		"-color_range", "2",
-		"-vf", fmt.Sprintf("scale=in_range=pc:out_range=pc,scale=%s,fps=%v,eq=brightness=%.2f:contrast=%.2f:saturation=%.2f,unsharp=luma_msize_x=3:luma_msize_y=3:luma_amount=%.2f", camera.Resolution, camera.FPS, (float64(camera.Brightness)-50.0)/50.0, float64(camera.Contrast)/50.0, float64(camera.Saturation)/50.0, (float64(camera.Sharpness)-50.0)/50.0),
-		"-c:v", "mjpeg",
-		"-loglevel", "verbose",
-		"-q:v", strconv.Itoa(2 + (100-camera.Quality)*(31-2)/(100-1)),
-		"-f", "mjpeg", "-",
-	}
-
-	//* Build command
-	ffmpegCmdsMutex.Lock()
-	ffmpegCmds[camera.Name] = exec.Command(ffmpegPath, ffmpegArgs...)
-	ffmpegCmdsMutex.Unlock()
-	ffmpegCmds[camera.Name].SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	stderrReader, stderrWriter := io.Pipe()
-	ffmpegCmds[camera.Name].Stderr = stderrWriter
-	ffmpegOut, err := ffmpegCmds[camera.Name].StdoutPipe()
-	if err != nil {
-		log.Println("Error setting up stdout pipe for", camera.Name, ":", err)
-		return
-	}
-
-	//* Start FFMPEG for the specific camera
-	ffmpegCmdsMutex.Lock()
-	if err := ffmpegCmds[camera.Name].Start(); err != nil {
-		log.Println("Failed to start FFMPEG for", camera.Name, ":", err)
-		ffmpegCmdsMutex.Unlock()
-		return
-	}
-	ffmpegCmdsMutex.Unlock()
-
-	//. Monitor FPS from stderr
-	go monitorFPS(stderrReader, camera)
-
-	//. Process Frames
-	go processFrames(ffmpegOut, camera, stream)
-}
-
-func processFrames(ffmpegOut io.ReadCloser, camera CameraSettings, stream chan []byte) {
-	jpegEnd := []byte{0xFF, 0xD9}
-	var buffer []byte
-	var bufferSize = calculateBufferSize(camera.Resolution) * 5
-
-	readBuffer := make([]byte, bufferSize)
-
-	for {
-		n, err := ffmpegOut.Read(readBuffer)
-		if err != nil {
-			return
+	case engine.CamerasChanged:
+		syncTabs()
+		refreshToggleButton()
+	case engine.SettingsChanged:
+		reloadCameraTab(event.Camera)
+		refreshToggleButton()
+	case engine.MotionStarted, engine.MotionEnded:
+		if selectedCamera == event.Camera {
+			showCaptureStatus()
 		}
-		buffer = append(buffer, readBuffer[:n]...)
-
-		for {
-			idx := bytes.Index(buffer, jpegEnd)
-			if idx == -1 {
-				break
-			}
-
-			frame := buffer[:idx+2]
-
-			if selectedCamera == camera.Name && toggleButton.Text == "Stop" && previewCheckbox.Checked {
-				streamImg.SetResource(fyne.NewStaticResource("frame.jpeg", frame))
-				streamImg.Refresh()
-			}
-
-			select {
-			case stream <- frame:
-			case <-stopChan:
-				ffmpegOut.Close()
-				return
-			default:
+	case engine.StateChanged:
+		if selectedCamera == event.Camera {
+			showCaptureStatus()
+			if eng.Running(selectedCamera) {
+				openStreamButton.Enable()
+			} else {
+				openStreamButton.Disable()
 			}
-
-			buffer = buffer[idx+2:]
-		}
-
-		if len(buffer) > bufferSize {
-			buffer = buffer[len(buffer)-bufferSize:]
 		}
 	}
 }
 
-func monitorFPS(stderrReader io.ReadCloser, camera CameraSettings) {
-	defer stderrReader.Close()
-
-	reFPS := regexp.MustCompile(`fps=\s*(\d+)`)
+// . Update the controls when streaming starts or stops
+func showStreamingState() {
+	if eng.Streaming() {
+		toggleButton.SetText("Stop")
 
-	scanner := bufio.NewScanner(stderrReader)
-	scanner.Split(bufio.ScanLines)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := reFPS.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			if selectedCamera == camera.Name && toggleButton.Text == "Stop" {
-				currentFpsLabel.Text = "FPS: " + matches[1]
-				intFPS, _ := strconv.Atoi(matches[1])
-				currentFpsLabel.Color = general.GetColorForFPS(intFPS)
-				currentFpsLabel.Refresh()
-			}
+		// Enable the "Open Stream URL" button for the selected camera
+		if eng.Running(selectedCamera) {
+			openStreamButton.Enable()
 		}
+	} else {
+		toggleButton.SetText("Start")
+		currentFpsLabel.Text = "FPS: N/A"
+		currentFpsLabel.Color = colormap.OffWhite
+		currentFpsLabel.Refresh()
+		streamImg.SetResource(fyne.NewStaticResource("nostream.png", noStreamImg))
+		streamImg.Refresh()
+		openStreamButton.Disable()
 	}
+	showCaptureStatus()
 }
 
-func calculateBufferSize(resolution string) int {
-	re := regexp.MustCompile(`(\d+)x(\d+)`)
-	matches := re.FindStringSubmatch(resolution)
-	if len(matches) < 3 {
-		return 0
+// . Enable the toggle button only while a camera is enabled
+func refreshToggleButton() {
+	anyCameraEnabled := false
+	for _, cam := range eng.Cameras() {
+		if cam.Enabled {
+			anyCameraEnabled = true
+			break
+		}
 	}
 
-	width, _ := strconv.Atoi(matches[1])
-	height, _ := strconv.Atoi(matches[2])
-	uncompressedSize := width * height * 24 / 8
-	estimatedJPEGSize := uncompressedSize / 20
-	return estimatedJPEGSize + int(0.2*float64(estimatedJPEGSize))
-}
-
-// . Get camera names
-func getCameraNames() []string {
-	//* Build command
-	cmd := exec.Command(ffmpegPath, "-list_devices", "true", "-f", "dshow", "-i", "dummy")
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-
-	//* Create buffer
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	//* Run command
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Command Error:", err)
+	if anyCameraEnabled {
+		toggleButton.Enable()
+	} else {
+		toggleButton.Disable()
 	}
+}
 
-	//* Parse data
-	re := regexp.MustCompile(`"([^"]+)" \(video\)`)
-	matches := re.FindAllStringSubmatch(out.String(), -1)
-
-	//* Create slice
-	cameraNames := make([]string, len(matches))
-	for i, match := range matches {
-		cameraNames[i] = match[1]
+// . List who can log in, nobody has to while there are no users
+func showUsers() {
+	users := eng.Users()
+	switch {
+	case len(users) == 0:
+		usersLabel.SetText("No login required")
+	case len(users) <= 3:
+		usersLabel.SetText("Users: " + strings.Join(users, ", "))
+	default:
+		usersLabel.SetText(fmt.Sprintf("%d users", len(users)))
 	}
-
-	return cameraNames
 }
 
-// . Get camera resolution
-func getCameraResolutions(deviceName string) []string {
-	//* Build command
-	cmd := exec.Command(ffmpegPath, "-list_options", "true", "-f", "dshow", "-i", "video="+deviceName)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-
-	//* Create buffer
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
-	if err != nil {
-		fmt.Printf("Res Error with device %s: %v. Output: %s\n", deviceName, err, out.String())
+// . Show the capture state of the selected camera
+func showCaptureStatus() {
+	status, ok := eng.Status(selectedCamera)
+	if !ok {
+		captureStatusLabel.Text = ""
+		captureStatusLabel.Refresh()
+		return
 	}
 
-	//* Parse data
-	re := regexp.MustCompile(`(\d+)x(\d+) fps=(\d+)`)
-	matches := re.FindAllStringSubmatch(out.String(), -1)
-
-	//* Get unique resolutions
-	uniqueResolutions := make(map[string]bool)
-	var resolutions []string
-	var maxFps int
-
-	//* Loop through resolutions
-	for _, match := range matches {
-		width, _ := strconv.Atoi(match[1])
-		height, _ := strconv.Atoi(match[2])
-		fps, _ := strconv.Atoi(match[3])
-
-		//* Set max FPS
-		if fps > maxFps {
-			maxFps = fps
-		}
-
-		resKey := fmt.Sprintf("%dx%d", width, height)
-		if !uniqueResolutions[resKey] {
-			//* Unique resolution found
-			resolutions = append(resolutions, resKey)
-			uniqueResolutions[resKey] = true
-		}
+	text := string(status.State)
+	switch status.State {
+	case engine.StateRunning:
+		captureStatusLabel.Color = colormap.Green
+	case engine.StateRestarting:
+		captureStatusLabel.Color = colormap.Yellow
+		text = fmt.Sprintf("%s (restart %d)", text, status.Restarts+1)
+	case engine.StateFailed:
+		captureStatusLabel.Color = colormap.Red
+	case engine.StateOffline:
+		captureStatusLabel.Color = colormap.Gray
+	default:
+		captureStatusLabel.Color = colormap.OffWhite
 	}
-
-	//. Update max FPS label and slider
-	for i, cam := range cameras {
-		if cam.Name == deviceName {
-			cameras[i].MaxFPS = maxFps
-			break
-		}
+	if status.State != engine.StateRunning && status.LastError != "" {
+		text += ": " + status.LastError
+	}
+	if len(text) > 60 {
+		text = text[:57] + "..."
+	}
+	if status.Recording {
+		text += " • REC"
+	}
+	if status.Motion {
+		text += " • MOTION"
+	} else if events := eng.MotionEvents(selectedCamera); len(events) > 0 {
+		text += " • motion at " + events[len(events)-1].Start.Format("15:04:05")
 	}
 
-	//* Sort resolutions
-	sort.Slice(resolutions, func(i, j int) bool {
-		partsI := strings.Split(resolutions[i], "x")
-		widthI, _ := strconv.Atoi(partsI[0])
-		heightI, _ := strconv.Atoi(partsI[1])
-
-		partsJ := strings.Split(resolutions[j], "x")
-		widthJ, _ := strconv.Atoi(partsJ[0])
-		heightJ, _ := strconv.Atoi(partsJ[1])
-
-		if widthI != widthJ {
-			return widthI < widthJ
-		}
-		return heightI < heightJ
-	})
-
-	return resolutions
+	captureStatusLabel.Text = text
+	captureStatusLabel.Refresh()
 }
 
 // . Generate app tabs for each camera
@@ -555,10 +407,11 @@ func genTabs() *container.AppTabs {
 
 		streamImg.SetResource(fyne.NewStaticResource("nostream.png", noStreamImg))
 		streamImg.Refresh()
-		selectedCamera = ti.Text // Set the selected camera
+		selectedCamera = tabCameras[ti] // Set the selected camera
+		showCaptureStatus()
 
 		// Enable the "Open Stream URL" button if the selected camera is running
-		if _, streamRunning := streams[selectedCamera]; streamRunning {
+		if eng.Running(selectedCamera) {
 			openStreamButton.Enable()
 		} else {
 			openStreamButton.Disable()
@@ -567,63 +420,117 @@ func genTabs() *container.AppTabs {
 		globals.App.Settings().SetTheme(fyneTheme.CustomTheme{})
 	}
 	tabs.SetTabLocation(container.TabLocationLeading)
-	names := getCameraNames()
-
-	for _, name := range names {
-		cameras = append(cameras, CameraSettings{Name: name})
-		tabs.Append(container.NewTabItem(name, genConfigContainer(name)))
+	cameraTabs = tabs
+	cameras := eng.Cameras()
+	for _, camera := range cameras {
+		tabs.Append(newCameraTab(camera))
 	}
 
-	allowSaving = true
-
 	if len(cameras) > 0 {
-		selectedCamera = cameras[0].Name
+		selectedCamera = cameras[0].ID
 	}
 
 	return tabs
 }
 
-// . Generate configuration container for a camera
-func genConfigContainer(cameraName string) *fyne.Container {
-	var index int
-	for i, cam := range cameras {
-		if cam.Name == cameraName {
-			index = i
-			break
+// Tabs show the camera's name but are tracked by its ID
+func newCameraTab(camera engine.CameraSettings) *container.TabItem {
+	item := container.NewTabItem(tabTitle(camera), genConfigContainer(camera.ID))
+	tabCameras[item] = camera.ID
+	return item
+}
+
+func tabTitle(camera engine.CameraSettings) string {
+	if !eng.Online(camera.ID) {
+		return camera.Name + " (offline)"
+	}
+	return camera.Name
+}
+
+// Rebuild a tab's widgets after its camera was changed elsewhere
+func reloadCameraTab(cameraID string) {
+	camera, ok := eng.Camera(cameraID)
+	if !ok {
+		return
+	}
+	for item, id := range tabCameras {
+		if id == cameraID {
+			item.Text = tabTitle(camera)
+			item.Content = genConfigContainer(cameraID)
 		}
 	}
+	cameraTabs.Refresh()
+}
 
-	settingsMap := loadSettings()
+// . Follow cameras being plugged in, unplugged, added and removed
+func syncTabs() {
+	cameras := eng.Cameras()
+	known := make(map[string]engine.CameraSettings)
+	for _, camera := range cameras {
+		known[camera.ID] = camera
+	}
 
-	// Initialize variables to hold default values
-	var enabledDefault bool
-	var resolutionDefault string
-	var fpsDefault float64 = 30
-	var qualityDefault float64 = 100
-	var brightnessDefault float64 = 50
-	var contrastDefault float64 = 50
-	var saturationDefault float64 = 50
-	var sharpnessDefault float64 = 50
+	//* Drop tabs of cameras that are gone, retitle the rest
+	for item, id := range tabCameras {
+		camera, ok := known[id]
+		if !ok {
+			cameraTabs.Remove(item)
+			delete(tabCameras, item)
+			continue
+		}
+		item.Text = tabTitle(camera)
+		delete(known, id)
+	}
 
-	// If settings for the camera exist, overwrite default values
-	if camSettings, exists := settingsMap[cameraName]; exists {
-		enabledDefault = camSettings.Enabled
-		resolutionDefault = camSettings.Resolution
-		fpsDefault = float64(camSettings.FPS)
-		qualityDefault = float64(camSettings.Quality)
-		brightnessDefault = float64(camSettings.Brightness)
-		contrastDefault = float64(camSettings.Contrast)
-		saturationDefault = float64(camSettings.Saturation)
-		sharpnessDefault = float64(camSettings.Sharpness)
+	//* Add tabs for new cameras, in the engine's order
+	for _, camera := range cameras {
+		if _, ok := known[camera.ID]; ok {
+			cameraTabs.Append(newCameraTab(camera))
+		}
 	}
+	cameraTabs.Refresh()
 
+	if cameraTabs.Selected() == nil && len(cameraTabs.Items) > 0 {
+		cameraTabs.SelectIndex(0)
+	}
+}
+
+// . Generate configuration container for a camera
+func genConfigContainer(cameraID string) *fyne.Container {
+	camera, _ := eng.Camera(cameraID)
+
+	// The loaded settings are the widgets' starting values
+	enabledDefault := camera.Enabled
+	resolutionDefault := camera.Resolution
+	fpsDefault := float64(camera.FPS)
+	qualityDefault := float64(camera.Quality)
+	brightnessDefault := float64(camera.Brightness)
+	contrastDefault := float64(camera.Contrast)
+	saturationDefault := float64(camera.Saturation)
+	sharpnessDefault := float64(camera.Sharpness)
+	timestampDefault := camera.Timestamp
+	recordDefault := camera.Record
+	clipsDefault := camera.Clips
+	timelapseDefault := camera.Timelapse
+	motionDefault := camera.Motion
+	motionSensitivityDefault := float64(camera.MotionSensitivity)
+	motionMinAreaDefault := float64(camera.MotionMinArea)
+
+	var nameEntry *widget.Entry
 	var enabledCheck *widget.Check
+	var recordCheck *widget.Check
+	var clipsCheck *widget.Check
+	var timelapseCheck *widget.Check
+	var timelapseEntry *widget.Entry
 	var resSelect *widget.Select
+	var formatSelect *widget.Select
+	var showMode func()
 	var fpsLabel = widget.NewLabel(fmt.Sprintf("FPS (%v)", fpsDefault))
 	var fpsSlider *widget.Slider
 	var qualityLabel = widget.NewLabel(fmt.Sprintf("Quality (%v)", qualityDefault))
 	var qualitySlider *widget.Slider
-	var portLabel = widget.NewLabel("808" + strconv.Itoa(index))
+	var portEntry *widget.Entry
+	var allowedUsersEntry *widget.Entry
 	var brightnessLabel = widget.NewLabel(fmt.Sprintf("Brightness (%v)", brightnessDefault))
 	var brightnessSlider *widget.Slider
 	var contrastLabel *widget.Label = widget.NewLabel(fmt.Sprintf("Contrast (%v)", contrastDefault))
@@ -632,69 +539,175 @@ func genConfigContainer(cameraName string) *fyne.Container {
 	var saturationSlider *widget.Slider
 	var sharpnessLabel = widget.NewLabel(fmt.Sprintf("Sharpness (%v)", sharpnessDefault))
 	var sharpnessSlider *widget.Slider
+	var timestampCheck *widget.Check
+	var motionCheck *widget.Check
+	var motionSensitivityLabel = widget.NewLabel(fmt.Sprintf("Sensitivity (%v)", motionSensitivityDefault))
+	var motionSensitivitySlider *widget.Slider
+	var motionMinAreaLabel = widget.NewLabel(fmt.Sprintf("Min Area (%v%%)", motionMinAreaDefault))
+	var motionMinAreaSlider *widget.Slider
+	var motionZonesEntry *widget.Entry
+
+	//. Name entry, the tab follows it
+	nameEntry = &widget.Entry{Text: camera.Name}
+	nameEntry.OnSubmitted = func(name string) {
+		if err := eng.RenameCamera(cameraID, name); err != nil {
+			dialog.ShowError(err, globals.Win)
+		}
+		camera, _ := eng.Camera(cameraID)
+		nameEntry.SetText(camera.Name)
+		for item, id := range tabCameras {
+			if id == cameraID {
+				item.Text = tabTitle(camera)
+				cameraTabs.Refresh()
+			}
+		}
+	}
+
+	//. Allowed users entry, empty lets every user watch
+	allowedUsersEntry = &widget.Entry{Text: camera.AllowedUsers, PlaceHolder: "Every user"}
+	allowedUsersEntry.OnSubmitted = func(users string) {
+		updateCamera(cameraID, func(cam *engine.CameraSettings) {
+			cam.AllowedUsers = strings.Join(engine.AllowedUsers(engine.CameraSettings{AllowedUsers: users}), ",")
+		})
+		camera, _ := eng.Camera(cameraID)
+		allowedUsersEntry.SetText(camera.AllowedUsers)
+	}
+
+	//. Port entry, the engine refuses ports that are taken
+	portEntry = &widget.Entry{Text: camera.Port, Validator: engine.ValidatePort}
+	portEntry.OnSubmitted = func(port string) {
+		updateCamera(cameraID, func(cam *engine.CameraSettings) {
+			cam.Port = port
+		})
+		camera, _ := eng.Camera(cameraID)
+		portEntry.SetText(camera.Port)
+	}
 
 	//. Enabled checkbox
 	enabledCheck = &widget.Check{
 		Checked: enabledDefault,
 		OnChanged: func(checked bool) {
-			cameras[index].Enabled = checked
-			saveSettings(cameraName)
-
-			anyCameraEnabled := false
-			for _, cam := range cameras {
-				if cam.Enabled {
-					anyCameraEnabled = true
-					break
-				}
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Enabled = checked
+			})
+			refreshToggleButton()
+		},
+	}
 
-			if anyCameraEnabled {
-				toggleButton.Enable()
-			} else {
-				toggleButton.Disable()
-			}
+	//. Record checkbox, recording only runs while streaming
+	recordCheck = &widget.Check{
+		Checked: recordDefault,
+		OnChanged: func(checked bool) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Record = checked
+			})
+		},
+	}
 
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+	//. Clip buffer checkbox, motion and the Save Clip button save clips from it
+	clipsCheck = &widget.Check{
+		Checked: clipsDefault,
+		OnChanged: func(checked bool) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Clips = checked
+			})
 		},
 	}
+	saveClipButton := &widget.Button{Text: "Save Clip", OnTapped: func() {
+		if err := eng.TriggerClip(cameraID); err != nil {
+			dialog.ShowError(errors.New("clips are saved while the camera streams with Clips checked"), globals.Win)
+		}
+	}}
+
+	//. Timelapse checkbox, seconds between frames and export
+	timelapseCheck = &widget.Check{
+		Checked: timelapseDefault,
+		OnChanged: func(checked bool) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Timelapse = checked
+			})
+		},
+	}
+	timelapseEntry = &widget.Entry{Text: strconv.Itoa(camera.TimelapseSeconds), Validator: validateCount}
+	timelapseEntry.OnSubmitted = func(text string) {
+		if seconds, err := strconv.Atoi(text); err == nil {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.TimelapseSeconds = seconds
+			})
+		}
+		camera, _ := eng.Camera(cameraID)
+		timelapseEntry.SetText(strconv.Itoa(camera.TimelapseSeconds))
+	}
+	exportButton := &widget.Button{Text: "Export", OnTapped: func() {
+		showTimelapseDialog(cameraID)
+	}}
 
 	//. Resolution drop down
 	resSelect = &widget.Select{
 		PlaceHolder: "Resolution",
-		Options:     getCameraResolutions(cameraName),
+		Options:     eng.Resolutions(cameraID, camera.Format),
 		Selected:    resolutionDefault,
 		OnChanged: func(selected string) {
-			cameras[index].Resolution = selected
-			saveSettings(cameraName)
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Resolution = selected
+				fitToModes(cam)
+			})
+			showMode()
+		},
+	}
 
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+	//. Format drop down
+	formatSelect = &widget.Select{
+		Options:  formatOptions(cameraID, resolutionDefault),
+		Selected: formatOption(camera.Format),
+		OnChanged: func(selected string) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Format = selected
+				if selected == autoFormat {
+					cam.Format = ""
+				}
+				fitToModes(cam)
+			})
+			showMode()
 		},
 	}
 
-	//. FPS slider
+	//. FPS slider, limited to what the device supports in the selected mode
+	minFps, maxFps := eng.FPSRange(cameraID, camera.Resolution, camera.Format)
 	fpsSlider = &widget.Slider{
-		Min:   2,
-		Max:   30,
+		Min:   float64(minFps),
+		Max:   float64(maxFps),
 		Value: fpsDefault,
 		OnChanged: func(f float64) {
 			fpsLabel.SetText(fmt.Sprintf("FPS (%v)", int(f)))
 		},
 		OnChangeEnded: func(f float64) {
-			cameras[index].FPS = int(f)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.FPS = int(f)
+			})
 		},
 	}
 
+	// Show the saved mode without triggering the widgets' callbacks
+	showMode = func() {
+		camera, _ := eng.Camera(cameraID)
+
+		resSelect.Options = eng.Resolutions(cameraID, camera.Format)
+		resSelect.Selected = camera.Resolution
+		resSelect.Refresh()
+
+		formatSelect.Options = formatOptions(cameraID, camera.Resolution)
+		formatSelect.Selected = formatOption(camera.Format)
+		formatSelect.Refresh()
+
+		minFps, maxFps := eng.FPSRange(cameraID, camera.Resolution, camera.Format)
+		fpsSlider.Min = float64(minFps)
+		fpsSlider.Max = float64(maxFps)
+		fpsSlider.Value = float64(camera.FPS)
+		fpsSlider.Refresh()
+		fpsLabel.SetText(fmt.Sprintf("FPS (%v)", camera.FPS))
+	}
+
 	//. Qaulity slider
 	qualitySlider = &widget.Slider{
 		Min:   1,
@@ -704,12 +717,9 @@ func genConfigContainer(cameraName string) *fyne.Container {
 			qualityLabel.SetText(fmt.Sprintf("Quality (%v)", int(q)))
 		},
 		OnChangeEnded: func(q float64) {
-			cameras[index].Quality = int(q)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Quality = int(q)
+			})
 		},
 	}
 
@@ -722,12 +732,9 @@ func genConfigContainer(cameraName string) *fyne.Container {
 			brightnessLabel.SetText(fmt.Sprintf("Brightness (%v)", int(b)))
 		},
 		OnChangeEnded: func(b float64) {
-			cameras[index].Brightness = int(b)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Brightness = int(b)
+			})
 		},
 	}
 
@@ -740,12 +747,9 @@ func genConfigContainer(cameraName string) *fyne.Container {
 			contrastLabel.SetText(fmt.Sprintf("Contrast (%v)", int(c)))
 		},
 		OnChangeEnded: func(c float64) {
-			cameras[index].Contrast = int(c)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Contrast = int(c)
+			})
 		},
 	}
 
@@ -758,12 +762,9 @@ func genConfigContainer(cameraName string) *fyne.Container {
 			saturationLabel.SetText(fmt.Sprintf("Saturation (%v)", int(s)))
 		},
 		OnChangeEnded: func(s float64) {
-			cameras[index].Saturation = int(s)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Saturation = int(s)
+			})
 		},
 	}
 
@@ -776,45 +777,126 @@ func genConfigContainer(cameraName string) *fyne.Container {
 			sharpnessLabel.SetText(fmt.Sprintf("Sharpness (%v)", int(sh)))
 		},
 		OnChangeEnded: func(sh float64) {
-			cameras[index].Sharpness = int(sh)
-			saveSettings(cameraName)
-			if toggleButton.Text == "Stop" {
-				stopStreaming()
-				startStreaming()
-			}
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Sharpness = int(sh)
+			})
 		},
 	}
 
-	//. Set default resolutions
-	if resSelect.Selected == "" && len(resSelect.Options) > 0 {
-		resSelect.SetSelected(resSelect.Options[0])
+	//. Motion detection
+	motionCheck = &widget.Check{
+		Checked: motionDefault,
+		OnChanged: func(checked bool) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Motion = checked
+			})
+		},
+	}
+	motionSensitivitySlider = &widget.Slider{
+		Min:   1,
+		Max:   100,
+		Value: motionSensitivityDefault,
+		OnChanged: func(s float64) {
+			motionSensitivityLabel.SetText(fmt.Sprintf("Sensitivity (%v)", int(s)))
+		},
+		OnChangeEnded: func(s float64) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.MotionSensitivity = int(s)
+			})
+		},
+	}
+	motionMinAreaSlider = &widget.Slider{
+		Min:   1,
+		Max:   100,
+		Value: motionMinAreaDefault,
+		OnChanged: func(a float64) {
+			motionMinAreaLabel.SetText(fmt.Sprintf("Min Area (%v%%)", int(a)))
+		},
+		OnChangeEnded: func(a float64) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.MotionMinArea = int(a)
+			})
+		},
+	}
+
+	//* Zones are x,y,w,h in percent, "-" in front excludes one
+	motionZonesEntry = &widget.Entry{
+		Text:        camera.MotionZones,
+		PlaceHolder: "x,y,w,h;-x,y,w,h",
+		Validator: func(text string) error {
+			_, err := engine.ParseMotionZones(text)
+			return err
+		},
+	}
+	motionZonesEntry.OnSubmitted = func(zones string) {
+		updateCamera(cameraID, func(cam *engine.CameraSettings) {
+			cam.MotionZones = zones
+		})
+		camera, _ := eng.Camera(cameraID)
+		motionZonesEntry.SetText(camera.MotionZones)
+	}
+
+	//. Timestamp checkbox
+	timestampCheck = &widget.Check{
+		Checked: timestampDefault,
+		OnChanged: func(checked bool) {
+			updateCamera(cameraID, func(cam *engine.CameraSettings) {
+				cam.Timestamp = checked
+			})
+		},
+	}
+
+	generalForm := []fyne.CanvasObject{
+		&widget.Label{Text: "Name"},
+		nameEntry,
+		&widget.Label{Text: "Enabled"},
+		enabledCheck,
+		&widget.Label{Text: "Record"},
+		recordCheck,
+		&widget.Label{Text: "Clips"},
+		container.NewHBox(clipsCheck, saveClipButton),
+		&widget.Label{Text: "Timelapse (s)"},
+		container.NewBorder(nil, nil, timelapseCheck, exportButton, timelapseEntry),
+		&widget.Label{Text: "Resolution"},
+		resSelect,
+	}
+
+	//. Only devices that list their modes let a format be picked
+	if len(formatSelect.Options) > 1 {
+		generalForm = append(generalForm, &widget.Label{Text: "Format"}, formatSelect)
+	}
+
+	generalForm = append(generalForm,
+		fpsLabel,
+		fpsSlider,
+		qualityLabel,
+		qualitySlider,
+		&widget.Label{Text: "Port"},
+		portEntry,
+		&widget.Label{Text: "Allowed Users"},
+		allowedUsersEntry,
+	)
+
+	//. Only the test pattern can draw a timestamp
+	if camera.Source == (capture.TestPattern{}).Kind() {
+		generalForm = append(generalForm, &widget.Label{Text: "Timestamp"}, timestampCheck)
 	}
 
-	//. Set default camera setting
-	cameras[len(cameras)-1].Resolution = resSelect.Options[0]
-	cameras[len(cameras)-1].FPS = int(fpsSlider.Value)
-	cameras[len(cameras)-1].Quality = int(qualitySlider.Value)
-	cameras[len(cameras)-1].Port = portLabel.Text
-	cameras[len(cameras)-1].Enabled = enabledCheck.Checked
-	cameras[len(cameras)-1].Contrast = int(contrastSlider.Value)
-	cameras[len(cameras)-1].Brightness = int(brightnessSlider.Value)
-	cameras[len(cameras)-1].Saturation = int(saturationSlider.Value)
-	cameras[len(cameras)-1].Sharpness = int(sharpnessSlider.Value)
+	//. Network cameras show their URL and can be removed
+	if camera.Source == (capture.Network{}).Kind() {
+		generalForm = append(generalForm,
+			&widget.Label{Text: "URL"},
+			&widget.Label{Text: camera.URL, Wrapping: fyne.TextTruncate},
+			&widget.Label{Text: ""},
+			&widget.Button{Text: "Remove Camera", OnTapped: func() {
+				removeNetworkCamera(cameraID)
+			}},
+		)
+	}
 
 	return container.NewCenter(
 		container.NewHBox(
-			container.New(&fynecustom.MinWidthFormLayout{MinColWidth: 125},
-				&widget.Label{Text: "Enabled"},
-				enabledCheck,
-				&widget.Label{Text: "Resolution"},
-				resSelect,
-				fpsLabel,
-				fpsSlider,
-				qualityLabel,
-				qualitySlider,
-				&widget.Label{Text: "Port"},
-				portLabel,
-			),
+			container.New(&fynecustom.MinWidthFormLayout{MinColWidth: 125}, generalForm...),
 			container.New(&fynecustom.MinWidthFormLayout{MinColWidth: 125},
 				brightnessLabel,
 				brightnessSlider,
@@ -824,54 +906,281 @@ func genConfigContainer(cameraName string) *fyne.Container {
 				saturationSlider,
 				sharpnessLabel,
 				sharpnessSlider,
+				&widget.Label{Text: "Motion"},
+				motionCheck,
+				motionSensitivityLabel,
+				motionSensitivitySlider,
+				motionMinAreaLabel,
+				motionMinAreaSlider,
+				&widget.Label{Text: "Zones"},
+				motionZonesEntry,
 			),
 		),
 	)
 }
 
-func loadSettings() map[string]CameraSettings {
-	var loadedCameras []CameraSettings
-	data, err := os.ReadFile(general.RoamingDir() + "/FrameWave/settings.json")
-	if err != nil {
-		return make(map[string]CameraSettings)
+// . Capture formats
+// "Auto" leaves the choice to ffmpeg. Picking mjpeg lets the device's own JPEGs
+// be streamed without re-encoding when no adjustments are applied. The
+// resolutions and frame rates offered follow the selected format.
+const autoFormat = "Auto"
+
+func formatOptions(cameraID, resolution string) []string {
+	return append([]string{autoFormat}, eng.Formats(cameraID, resolution)...)
+}
+
+func formatOption(format string) string {
+	if format == "" {
+		return autoFormat
+	}
+	return format
+}
+
+// Keep a camera's format and frame rate valid after its resolution or format changed
+func fitToModes(cam *engine.CameraSettings) {
+	if !slices.Contains(eng.Formats(cam.ID, cam.Resolution), cam.Format) {
+		cam.Format = ""
+	}
+	minFps, maxFps := eng.FPSRange(cam.ID, cam.Resolution, cam.Format)
+	cam.FPS = min(max(cam.FPS, minFps), maxFps)
+}
+
+// . Network cameras
+func showAddCameraDialog() {
+	nameEntry := &widget.Entry{PlaceHolder: "Optional"}
+	urlEntry := &widget.Entry{PlaceHolder: "rtsp://, http:// or file path"}
+	urlEntry.Validator = func(text string) error {
+		if strings.TrimSpace(text) == "" {
+			return errors.New("a URL or file path is required")
+		}
+		return nil
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("URL", urlEntry),
+	}
+	dialog.ShowForm("Add Network Camera", "Add", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		streamURL := strings.TrimSpace(urlEntry.Text)
+		name := strings.TrimSpace(nameEntry.Text)
+		if name == "" {
+			name = networkCameraName(streamURL)
+		}
+		if err := addNetworkCamera(name, streamURL); err != nil {
+			dialog.ShowError(err, globals.Win)
+		}
+	}, globals.Win)
+}
+
+// Name a camera after the host of its URL, or the file it plays
+func networkCameraName(streamURL string) string {
+	if parsed, err := url.Parse(streamURL); err == nil && parsed.Host != "" {
+		return parsed.Host
 	}
-	err = json.Unmarshal(data, &loadedCameras)
+	return filepath.Base(streamURL)
+}
+
+func addNetworkCamera(name, streamURL string) error {
+	camera, err := eng.AddNetworkCamera(name, streamURL)
 	if err != nil {
-		return make(map[string]CameraSettings)
+		return err
 	}
 
-	settingsMap := make(map[string]CameraSettings)
-	for _, cam := range loadedCameras {
-		settingsMap[cam.Name] = cam
+	// The engine's CamerasChanged event has added the tab
+	for item, id := range tabCameras {
+		if id == camera.ID {
+			cameraTabs.Select(item)
+		}
 	}
-	return settingsMap
+	return nil
 }
 
-func saveSettings(updatedCameraName string) {
-	if !allowSaving {
-		return
+func removeNetworkCamera(cameraID string) {
+	if err := eng.RemoveCamera(cameraID); err != nil {
+		dialog.ShowError(err, globals.Win)
 	}
+}
+
+// . Recording settings
+var recordFormats = map[string]string{
+	"MJPEG (MKV)": engine.RecordMKV,
+	"H.264 (MP4)": engine.RecordMP4,
+}
+
+func showRecordingDialog() {
+	config := eng.Config()
 
-	settingsMap := loadSettings()
-	if settingsMap == nil {
-		settingsMap = make(map[string]CameraSettings)
+	dirEntry := &widget.Entry{Text: config.RecordDir}
+	formatSelect := &widget.Select{Options: []string{"MJPEG (MKV)", "H.264 (MP4)"}}
+	for option, format := range recordFormats {
+		if format == config.RecordFormat {
+			formatSelect.Selected = option
+		}
+	}
+	var segmentOptions []string
+	for _, minutes := range engine.SegmentLengths {
+		segmentOptions = append(segmentOptions, segmentOption(minutes))
 	}
+	segmentSelect := &widget.Select{Options: segmentOptions, Selected: segmentOption(config.SegmentMinutes)}
+	daysEntry := &widget.Entry{Text: strconv.Itoa(config.RetentionDays), Validator: validateCount}
+	sizeEntry := &widget.Entry{Text: strconv.Itoa(config.RetentionGB), Validator: validateCount}
+	preRollEntry := &widget.Entry{Text: strconv.Itoa(config.PreRollSeconds), Validator: validateCount}
+	postRollEntry := &widget.Entry{Text: strconv.Itoa(config.PostRollSeconds), Validator: validateCount}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Directory", dirEntry),
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Segments", segmentSelect),
+		{Text: "Keep days", Widget: daysEntry, HintText: "0 keeps recordings forever"},
+		{Text: "Max size (GB)", Widget: sizeEntry, HintText: "0 doesn't limit their size"},
+		{Text: "Clip pre-roll (s)", Widget: preRollEntry, HintText: "Kept in memory before an event"},
+		{Text: "Clip post-roll (s)", Widget: postRollEntry, HintText: "Recorded after the last event"},
+	}
+	dialog.ShowForm("Recording Settings", "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
 
-	for _, cam := range cameras {
-		if cam.Name == updatedCameraName {
-			settingsMap[updatedCameraName] = cam
-			break
+		config := eng.Config()
+		if dir := strings.TrimSpace(dirEntry.Text); dir != "" {
+			config.RecordDir = dir
+		}
+		config.RecordFormat = recordFormats[formatSelect.Selected]
+		for _, minutes := range engine.SegmentLengths {
+			if segmentOption(minutes) == segmentSelect.Selected {
+				config.SegmentMinutes = minutes
+			}
+		}
+		config.RetentionDays, _ = strconv.Atoi(daysEntry.Text)
+		config.RetentionGB, _ = strconv.Atoi(sizeEntry.Text)
+		config.PreRollSeconds, _ = strconv.Atoi(preRollEntry.Text)
+		config.PostRollSeconds, _ = strconv.Atoi(postRollEntry.Text)
+		if err := eng.UpdateConfig(config); err != nil {
+			dialog.ShowError(err, globals.Win)
+		}
+		showCaptureStatus()
+	}, globals.Win)
+}
+
+// . HTTPS settings
+var plainHTTPModes = map[string]string{
+	"Allow":             engine.PlainHTTPAllow,
+	"Redirect to HTTPS": engine.PlainHTTPRedirect,
+	"Refuse":            engine.PlainHTTPRefuse,
+}
+
+func showHTTPSDialog() {
+	config := eng.Config()
+
+	tlsCheck := &widget.Check{Text: "Serve HTTPS", Checked: config.TLS}
+	certEntry := &widget.Entry{Text: config.CertFile, PlaceHolder: "Self-signed"}
+	keyEntry := &widget.Entry{Text: config.KeyFile, PlaceHolder: "Self-signed"}
+	plainSelect := &widget.Select{Options: []string{"Allow", "Redirect to HTTPS", "Refuse"}}
+	for option, mode := range plainHTTPModes {
+		if mode == config.PlainHTTP {
+			plainSelect.Selected = option
 		}
 	}
 
-	var updatedCameras []CameraSettings
-	for _, cam := range settingsMap {
-		updatedCameras = append(updatedCameras, cam)
+	items := []*widget.FormItem{
+		widget.NewFormItem("", tlsCheck),
+		{Text: "Certificate", Widget: certEntry, HintText: "PEM file, leave empty to generate one"},
+		widget.NewFormItem("Key", keyEntry),
+		widget.NewFormItem("Plain HTTP", plainSelect),
 	}
+	dialog.ShowForm("HTTPS Settings", "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
 
-	data, err := json.MarshalIndent(updatedCameras, "", "  ")
-	if err != nil {
+		config := eng.Config()
+		config.TLS = tlsCheck.Checked
+		config.CertFile = strings.TrimSpace(certEntry.Text)
+		config.KeyFile = strings.TrimSpace(keyEntry.Text)
+		if config.KeyFile == "" {
+			config.KeyFile = config.CertFile
+		}
+		config.PlainHTTP = plainHTTPModes[plainSelect.Selected]
+		if err := eng.UpdateConfig(config); err != nil {
+			dialog.ShowError(err, globals.Win)
+		} else if err := eng.APIError(); err != nil {
+			dialog.ShowError(err, globals.Win)
+		}
+	}, globals.Win)
+}
+
+// . Timelapse export
+const timelapseRangeFormat = "2006-01-02 15:04"
+
+func showTimelapseDialog(cameraID string) {
+	days := eng.TimelapseDays(cameraID)
+	if len(days) == 0 {
+		dialog.ShowInformation("Export Timelapse", "No timelapse frames have been saved yet.", globals.Win)
 		return
 	}
-	os.WriteFile(general.RoamingDir()+"/FrameWave/settings.json", data, 0644)
+
+	//* Default to the latest day
+	from, _ := time.ParseInLocation("2006-01-02", days[len(days)-1], time.Local)
+	to := from.AddDate(0, 0, 1)
+	validateTime := func(text string) error {
+		_, err := time.ParseInLocation(timelapseRangeFormat, text, time.Local)
+		return err
+	}
+	fromEntry := &widget.Entry{Text: from.Format(timelapseRangeFormat), Validator: validateTime}
+	toEntry := &widget.Entry{Text: to.Format(timelapseRangeFormat), Validator: validateTime}
+	fpsEntry := &widget.Entry{Text: "30", Validator: validateCount}
+
+	items := []*widget.FormItem{
+		{Text: "From", Widget: fromEntry, HintText: timelapseRangeFormat},
+		{Text: "To", Widget: toEntry},
+		widget.NewFormItem("FPS", fpsEntry),
+	}
+	dialog.ShowForm("Export Timelapse", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		from, _ := time.ParseInLocation(timelapseRangeFormat, fromEntry.Text, time.Local)
+		to, _ := time.ParseInLocation(timelapseRangeFormat, toEntry.Text, time.Local)
+		fps, _ := strconv.Atoi(fpsEntry.Text)
+
+		progress := dialog.NewProgressInfinite("Export Timelapse", "Encoding...", globals.Win)
+		progress.Show()
+		go func() {
+			path, err := eng.ExportTimelapse(cameraID, from, to, fps)
+			progress.Hide()
+			if err != nil {
+				dialog.ShowError(err, globals.Win)
+				return
+			}
+			dialog.ShowInformation("Export Timelapse", "Saved "+path, globals.Win)
+		}()
+	}, globals.Win)
+}
+
+func segmentOption(minutes int) string {
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+func validateCount(text string) error {
+	if n, err := strconv.Atoi(text); err != nil || n < 0 {
+		return errors.New("must be 0 or more")
+	}
+	return nil
+}
+
+// Apply a change to one camera's settings, the engine applies it to the running stream
+func updateCamera(cameraID string, change func(camera *engine.CameraSettings)) {
+	camera, ok := eng.Camera(cameraID)
+	if !ok {
+		return
+	}
+	change(&camera)
+	if err := eng.UpdateCamera(camera); err != nil {
+		dialog.ShowError(err, globals.Win)
+	}
 }